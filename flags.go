@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/PouuleT/traffic-simulator/simulator"
+)
+
+// headerFlag is a repeatable flag adding headers to a map
+type headerFlag map[string]string
+
+// String returns the headers as written on the command line
+func (h headerFlag) String() string {
+	var headers []string
+	for _, key := range slices.Sorted(maps.Keys(h)) {
+		headers = append(headers, key+": "+h[key])
+	}
+	return strings.Join(headers, ", ")
+}
+
+// Set adds a header written as "Name: value"
+func (h headerFlag) Set(value string) error {
+	name, v, ok := strings.Cut(value, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("invalid header %q, expected \"Name: value\"", value)
+	}
+	h[http.CanonicalHeaderKey(name)] = strings.TrimSpace(v)
+	return nil
+}
+
+// paramFlag is a repeatable flag adding the parameters of a traffic type to a
+// map
+type paramFlag map[string]string
+
+// String returns the parameters as written on the command line
+func (p paramFlag) String() string {
+	var params []string
+	for _, key := range slices.Sorted(maps.Keys(p)) {
+		params = append(params, key+"="+p[key])
+	}
+	return strings.Join(params, ", ")
+}
+
+// Set adds a parameter written as "key=value"
+func (p paramFlag) Set(value string) error {
+	key, v, ok := strings.Cut(value, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("invalid parameter %q, expected \"key=value\"", value)
+	}
+	p[key] = v
+	return nil
+}
+
+// thresholdsFlag is a repeatable flag adding thresholds to a list
+type thresholdsFlag struct {
+	thresholds *[]*simulator.Threshold
+	abort      bool
+}
+
+// String returns the thresholds of the flag
+func (f thresholdsFlag) String() string {
+	if f.thresholds == nil {
+		return ""
+	}
+	var exprs []string
+	for _, t := range *f.thresholds {
+		if t.Abort == f.abort {
+			exprs = append(exprs, t.String())
+		}
+	}
+	return strings.Join(exprs, ", ")
+}
+
+// Set adds a threshold
+func (f thresholdsFlag) Set(value string) error {
+	t, err := simulator.ParseThreshold(value)
+	if err != nil {
+		return err
+	}
+	t.Abort = f.abort
+	*f.thresholds = append(*f.thresholds, t)
+	return nil
+}
@@ -1,11 +1,12 @@
 module github.com/PouuleT/traffic-simulator
 
-go 1.23.1
+go 1.24.0
 
 require (
 	github.com/dustin/go-humanize v1.0.1
 	github.com/fatih/color v1.18.0
 	github.com/olekukonko/tablewriter v0.0.5
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -1,19 +1,24 @@
 package main
 
 import (
-	"errors"
+	"context"
 	"flag"
 	"log"
-	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
+
+	"github.com/PouuleT/traffic-simulator/simulator"
 )
 
-var (
-	// URLs represents the list of URL to test
-	URLs = []string{}
-	// ErrInvalidTrafficType is returned if the traffic type is invalid
-	ErrInvalidTrafficType = errors.New("invalid traffic type")
+// ExitThresholdsFailed is the exit code of a run failing its thresholds
+const ExitThresholdsFailed = 3
 
+var (
 	nbOfClients           int
 	nbOfRequests          int
 	avgMillisecondsToWait int
@@ -22,40 +27,289 @@ var (
 	timeout               int
 	seed                  int64
 	followHttpRedirect    bool
+	rate                  float64
+	maxInFlight           int
+	duration              time.Duration
+	drain                 time.Duration
+	output                string
+	eventLogFile          string
+	metricsAddr           string
+	interval              time.Duration
+	configFile            string
+	waitDistribution      string
+	clientsProfile        string
+	rateProfile           string
+	connectionMode        string
+	httpMethod            string
+	body                  string
+	bodyFile              string
+	contentType           string
+	dataFile              string
+	tlsInsecure           bool
+	tlsCAFile             string
+	tlsCertFile           string
+	tlsKeyFile            string
+	tlsServerName         string
+	tlsMinVersion         string
+	tlsMaxVersion         string
+	compareFile           string
+	dnsServer             string
+	dnsTransport          string
+	recordType            string
+	dohMethod             string
+	thresholds            []*simulator.Threshold
+	abortAfter            time.Duration
 )
 
 func init() {
-	// Parse the arguments
-	flag.IntVar(&nbOfClients, "clients", 10, "number of clients making requests")
-	flag.IntVar(&nbOfRequests, "requests", 10, "number of requests to be made by each clients")
-	flag.IntVar(&avgMillisecondsToWait, "wait", 1000, "milliseconds to wait between each requests")
-	flag.IntVar(&timeout, "timeout", 3, "HTTP timeout in seconds")
-	flag.Int64Var(&seed, "seed", time.Now().UTC().UnixNano(), "seed for the random")
-	flag.StringVar(&trafficType, "type", "http", "type of requests http/dns")
-	flag.StringVar(&fileName, "urlSource", "", "optional filepath where to find the URLs")
-	flag.BoolVar(&followHttpRedirect, "followRedirect", true, "follow http redirects or not")
+	registerFlags(flag.CommandLine)
+}
+
+// registerFlags defines the flags of the command line on the flag set
+func registerFlags(fs *flag.FlagSet) {
+	fs.IntVar(&nbOfClients, "clients", 10, "number of clients making requests")
+	fs.IntVar(&nbOfRequests, "requests", 10, "number of requests to be made by each clients")
+	fs.IntVar(&avgMillisecondsToWait, "wait", 1000, "milliseconds to wait between each requests")
+	fs.StringVar(&waitDistribution, "waitDistribution", simulator.ConstantWait, "distribution of the wait around -wait: constant, uniform[:minMs,maxMs], exponential, normal[:stddevMs] or lognormal[:sigma]")
+	fs.IntVar(&timeout, "timeout", 3, "HTTP timeout in seconds")
+	fs.Int64Var(&seed, "seed", time.Now().UTC().UnixNano(), "seed for the random")
+	fs.StringVar(&trafficType, "type", "http", "type of requests "+strings.Join(simulator.TrafficTypes(), "/")+", http2 uses h2c for the http URLs")
+	fs.StringVar(&dnsServer, "dnsServer", "", "host:port of the DNS server to query directly in dns mode, the system resolver by default, URL of the server in doh mode, host[:port] in dot mode")
+	fs.StringVar(&dohMethod, "dohMethod", http.MethodGet, "HTTP method of the queries in doh mode: GET or POST")
+	fs.StringVar(&dnsTransport, "dnsTransport", simulator.UDPTransport, "transport of the queries to -dnsServer: udp or tcp")
+	fs.StringVar(&recordType, "recordType", "A", "record type of the queries to -dnsServer: A, AAAA, MX, TXT, SRV, CNAME or NS")
+	fs.StringVar(&fileName, "urlSource", "", "optional filepath where to find the URLs")
+	fs.BoolVar(&followHttpRedirect, "followRedirect", true, "follow http redirects or not")
+	fs.StringVar(&httpMethod, "method", "", "HTTP method of the requests, GET by default, the URLs can override it")
+	fs.Var(paramFlag(params), "param", "parameter of the traffic type, like \"key=value\", can be repeated")
+	fs.Var(headerFlag(headers), "header", "header added to the HTTP requests, like \"Name: value\", can be repeated, a Host header overrides the host")
+	fs.StringVar(&body, "body", "", "body of the HTTP requests")
+	fs.StringVar(&bodyFile, "bodyFile", "", "optional filepath of the body of the HTTP requests")
+	fs.StringVar(&contentType, "contentType", "", "Content-Type of the HTTP requests with a body, guessed from the body by default")
+	fs.StringVar(&dataFile, "dataFile", "", "optional filepath of a CSV file whose first row names the columns, a random row is used by the {{csv \"column\"}} templates of each request")
+	fs.BoolVar(&tlsInsecure, "insecure", false, "skip the verification of the server certificates")
+	fs.StringVar(&tlsCAFile, "caFile", "", "optional filepath of a PEM bundle of the CAs to trust instead of the system ones")
+	fs.StringVar(&tlsCertFile, "certFile", "", "optional filepath of a PEM client certificate, for mutual TLS")
+	fs.StringVar(&tlsKeyFile, "keyFile", "", "optional filepath of the PEM key of the client certificate")
+	fs.StringVar(&tlsServerName, "serverName", "", "optional server name sent with SNI and checked against the certificates, the host of the URL by default")
+	fs.StringVar(&tlsMinVersion, "tlsMinVersion", "", "minimum TLS version: 1.0, 1.1, 1.2 or 1.3")
+	fs.StringVar(&tlsMaxVersion, "tlsMaxVersion", "", "maximum TLS version: 1.0, 1.1, 1.2 or 1.3")
+	fs.StringVar(&connectionMode, "connections", simulator.FreshConnections, "HTTP connections: shared between the workers, one pool per worker, or fresh for each request")
+	fs.Float64Var(&rate, "rate", 0, "number of requests per second to dispatch regardless of the clients, -requests becomes the total (0 to disable)")
+	fs.DurationVar(&duration, "duration", 0, "duration of the run, overrides -requests (0 to disable)")
+	fs.DurationVar(&drain, "drain", 3*time.Second, "time given to the requests in flight to finish once the run is over or interrupted, before they are aborted, 0 to abort them at once")
+	fs.StringVar(&eventLogFile, "eventLog", "", "optional filepath where to write each request as JSON Lines")
+	fs.StringVar(&metricsAddr, "metricsAddr", "", "optional address where to expose the Prometheus /metrics endpoint during the run")
+	fs.StringVar(&compareFile, "compare", "", "optional filepath of the JSON results of a previous run to compare with, like an http run to compare with http2")
+	fs.Var(thresholdsFlag{thresholds: &thresholds}, "threshold", "threshold checked against the final stats like \"p99<300ms\", \"error_rate<1%\", \"rps>500\" or \"status_5xx==0\", can be repeated, the run exits with 3 if one fails")
+	fs.Var(thresholdsFlag{thresholds: &thresholds, abort: true}, "abortThreshold", "threshold checked every second during the run, which is aborted as soon as it fails, can be repeated")
+	fs.DurationVar(&abortAfter, "abortAfter", 5*time.Second, "time to wait before checking the abort thresholds, for the stats to settle")
+	fs.StringVar(&output, "output", "", "optional filepath where to write the results, in CSV with a .csv extension, in JSON otherwise")
+	fs.DurationVar(&interval, "interval", 0, "interval between the progress reports during the run (0 to disable)")
+	fs.IntVar(&maxInFlight, "maxInFlight", 0, "maximum number of requests in flight in rate mode (0 for unlimited)")
+	fs.StringVar(&clientsProfile, "clientsProfile", "", "optional load profile varying the number of clients, like \"ramp:200:2m,hold:10m,spike:500:30s,ramp:0:1m\", sets -clients and -duration")
+	fs.StringVar(&rateProfile, "rateProfile", "", "optional load profile varying the rate, like \"ramp:200:2m,hold:10m\", sets -rate and -duration")
+	fs.StringVar(&configFile, "config", "", "optional filepath of a JSON or YAML scenario file, the flags override its values")
+}
+
+// parseFlags parses the command line and applies the scenario file, the flags
+// overriding its values
+func parseFlags() {
 	flag.Parse()
 
 	log.SetFlags(0)
+
+	// Load the scenario
+	if configFile != "" {
+		scenario, err := loadScenario(configFile)
+		if err != nil {
+			log.Fatalf("Error while loading the scenario %q: %s", configFile, err)
+		}
+		if err := scenario.apply(flag.CommandLine); err != nil {
+			log.Fatalf("Error while applying the scenario %q: %s", configFile, err)
+		}
+	}
+
+	resetConnectionMode(flag.CommandLine)
+
+	if drain < 0 {
+		log.Fatalf("Error while parsing the flags: -drain must not be negative")
+	}
+
+	// Read the body
+	if body != "" && bodyFile != "" {
+		log.Fatalf("Error while reading the body: -body and -bodyFile can't be used together")
+	}
+	if bodyFile != "" {
+		var fileContentType string
+		var err error
+		if body, fileContentType, err = simulator.ReadBodyFile(bodyFile); err != nil {
+			log.Fatalf("Error while reading the body: %s", err)
+		}
+		if contentType == "" {
+			contentType = fileContentType
+		}
+	}
+
 	log.Println("Random URLs using seed", seed)
-	rand.New(rand.NewSource(seed))
+}
+
+// resetConnectionMode leaves the connection mode to the traffic type unless
+// it is given by a flag or by the scenario: HTTP/2 multiplexes the requests of
+// all the workers on shared connections
+func resetConnectionMode(fs *flag.FlagSet) {
+	set := false
+	fs.Visit(func(f *flag.Flag) { set = set || f.Name == "connections" })
+	if !set {
+		connectionMode = ""
+	}
 }
 
 func main() {
+	parseFlags()
+
+	// Get the URLs
+	urls, err := getURLs()
+	if err != nil {
+		log.Fatalf("Error while getting the URLs: %q", err)
+	}
+
 	// Create the TrafficGenerator
-	trafficGenerator, err := NewTrafficGenerator(trafficType)
+	trafficGenerator, err := simulator.NewTrafficGenerator(simulator.Options{
+		Type:             trafficType,
+		Clients:          nbOfClients,
+		Requests:         nbOfRequests,
+		Wait:             time.Duration(avgMillisecondsToWait) * time.Millisecond,
+		WaitDistribution: waitDistribution,
+		Timeout:          time.Duration(timeout) * time.Second,
+		Seed:             seed,
+		FollowRedirect:   followHttpRedirect,
+		Rate:             rate,
+		MaxInFlight:      maxInFlight,
+		Duration:         duration,
+		Drain:            drain,
+		ClientsProfile:   clientsProfile,
+		RateProfile:      rateProfile,
+		Connections:      connectionMode,
+		URLs:             urls,
+		Method:           httpMethod,
+		Headers:          headers,
+		Body:             body,
+		ContentType:      contentType,
+		DataFile:         dataFile,
+		Params:           params,
+		TLS: simulator.TLSOptions{
+			Insecure:   tlsInsecure,
+			CAFile:     tlsCAFile,
+			CertFile:   tlsCertFile,
+			KeyFile:    tlsKeyFile,
+			ServerName: tlsServerName,
+			MinVersion: tlsMinVersion,
+			MaxVersion: tlsMaxVersion,
+		},
+		DNS: simulator.DNSOptions{
+			Server:     dnsServer,
+			Transport:  dnsTransport,
+			RecordType: recordType,
+			DoHMethod:  dohMethod,
+		},
+		Thresholds: thresholds,
+		AbortAfter: abortAfter,
+		Interval:   interval,
+		Log:        os.Stdout,
+	})
 	if err != nil {
 		log.Fatalf("Error while creating TrafficGenerator: %q", err)
 	}
 
-	// Get the URLs
-	if err := getURLs(); err != nil {
-		log.Fatalf("Error while getting the URLs: %q", err)
+	// Create the event log
+	var eventLog *simulator.EventLog
+	if eventLogFile != "" {
+		if eventLog, err = simulator.NewEventLog(eventLogFile); err != nil {
+			log.Fatalf("Error while creating the event log: %q", err)
+		}
+		trafficGenerator.SetEventLog(eventLog)
+	}
+
+	// Expose the metrics
+	var metrics *simulator.Metrics
+	if metricsAddr != "" {
+		metrics = simulator.NewMetrics()
+		if err := metrics.Serve(metricsAddr); err != nil {
+			log.Fatalf("Error while exposing the metrics: %q", err)
+		}
+		trafficGenerator.SetMetrics(metrics)
 	}
 
+	// Stop the workers on the first SIGINT / SIGTERM, quit on the second one
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-c
+		cancel()
+		<-c
+		os.Exit(1)
+	}()
+
 	// Generate the traffic
-	trafficGenerator.Generate()
+	trafficGenerator.Generate(ctx)
+
+	// Stop serving the metrics, the run is over
+	if metrics != nil {
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), time.Second)
+		if err := metrics.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error while stopping the metrics: %q", err)
+		}
+		cancelShutdown()
+	}
+
+	if eventLog != nil {
+		if err := eventLog.Close(); err != nil {
+			log.Fatalf("Error while writing the event log: %q", err)
+		}
+	}
 
 	// Display the statistics
 	trafficGenerator.DisplayStats()
+
+	// Compare with a previous run
+	if compareFile != "" {
+		if err := trafficGenerator.Compare(compareFile); err != nil {
+			log.Fatalf("Error while comparing the results: %q", err)
+		}
+	}
+
+	// Check the thresholds
+	passed := trafficGenerator.CheckThresholds()
+
+	// Write the results
+	if output != "" {
+		summary := trafficGenerator.Summary()
+		summary.Config.URLSource = fileName
+		summary.Config.ConfigFile = configFile
+		if err := summary.WriteFile(output); err != nil {
+			log.Fatalf("Error while writing the results: %q", err)
+		}
+	}
+
+	if !passed {
+		os.Exit(ExitThresholdsFailed)
+	}
+}
+
+// getURLs returns the URLs of the URL source, or the ones of the scenario, the
+// default URLs are used if there is none
+func getURLs() ([]simulator.URLEntry, error) {
+	if fileName == "" {
+		return scenarioURLs, nil
+	}
+
+	// Structured files use the same format as the urls of the scenario
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".json", ".yaml", ".yml":
+		return loadURLEntries(fileName)
+	}
+	return simulator.LoadURLs(fileName)
 }
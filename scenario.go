@@ -0,0 +1,656 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PouuleT/traffic-simulator/simulator"
+)
+
+var (
+	// scenarioURLs represents the URLs given by the scenario file
+	scenarioURLs = []simulator.URLEntry{}
+	// headers represents the headers added to every HTTP request
+	headers = map[string]string{}
+	// params represents the parameters of the traffic type
+	params = map[string]string{}
+)
+
+// Scenario represents a scenario file describing a whole run, every field is
+// optional and the flags override them
+type Scenario struct {
+	Type           string            `json:"type"`
+	Clients        *int              `json:"clients"`
+	Requests       *int              `json:"requests"`
+	Wait           *int              `json:"wait"`
+	WaitDist       string            `json:"wait_distribution"`
+	Rate           *float64          `json:"rate"`
+	MaxInFlight    *int              `json:"max_in_flight"`
+	ClientsProfile string            `json:"clients_profile"`
+	RateProfile    string            `json:"rate_profile"`
+	Duration       *ScenarioDuration `json:"duration"`
+	Drain          *ScenarioDuration `json:"drain"`
+	Timeout        *int              `json:"timeout"`
+	FollowRedirect *bool             `json:"follow_redirect"`
+	Connections    string            `json:"connections"`
+	Seed           *int64            `json:"seed"`
+	URLSource      string            `json:"url_source"`
+	URLs           []ScenarioURL     `json:"urls"`
+	Method         string            `json:"method"`
+	Headers        map[string]string `json:"headers"`
+	Body           string            `json:"body"`
+	BodyFile       string            `json:"body_file"`
+	ContentType    string            `json:"content_type"`
+	DataFile       string            `json:"data_file"`
+	Params         map[string]string `json:"params"`
+	TLS            ScenarioTLS       `json:"tls"`
+	DNS            ScenarioDNS       `json:"dns"`
+	Thresholds     []string          `json:"thresholds"`
+	AbortThreshold []string          `json:"abort_thresholds"`
+	AbortAfter     *ScenarioDuration `json:"abort_after"`
+	Output         ScenarioOutput    `json:"output"`
+}
+
+// ScenarioURL represents an URL of the scenario, its weight and the metadata
+// of its requests
+type ScenarioURL struct {
+	URL            string            `json:"url"`
+	Weight         *float64          `json:"weight"`
+	Method         string            `json:"method"`
+	Headers        map[string]string `json:"headers"`
+	Body           string            `json:"body"`
+	BodyFile       string            `json:"body_file"`
+	ContentType    string            `json:"content_type"`
+	ExpectedStatus []int             `json:"expected_status"`
+	ExpectedBody   string            `json:"expected_body"`
+	ExpectedRegex  string            `json:"expected_body_regex"`
+	ExpectedJSON   []string          `json:"expected_json"`
+	ExpectedHeader []string          `json:"expected_headers"`
+	MaxBodySize    int64             `json:"max_body_size"`
+}
+
+// ScenarioTLS represents the TLS options of the scenario
+type ScenarioTLS struct {
+	Insecure   *bool  `json:"insecure"`
+	CAFile     string `json:"ca_file"`
+	CertFile   string `json:"cert_file"`
+	KeyFile    string `json:"key_file"`
+	ServerName string `json:"server_name"`
+	MinVersion string `json:"min_version"`
+	MaxVersion string `json:"max_version"`
+}
+
+// ScenarioDNS represents the DNS options of the scenario
+type ScenarioDNS struct {
+	Server     string `json:"server"`
+	Transport  string `json:"transport"`
+	RecordType string `json:"record_type"`
+	DoHMethod  string `json:"doh_method"`
+}
+
+// ScenarioOutput represents the output sinks of the scenario
+type ScenarioOutput struct {
+	Summary     string            `json:"summary"`
+	EventLog    string            `json:"event_log"`
+	MetricsAddr string            `json:"metrics_addr"`
+	Interval    *ScenarioDuration `json:"interval"`
+}
+
+// ScenarioDuration represents a duration written as a string, like "1m30s"
+type ScenarioDuration time.Duration
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (d *ScenarioDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = ScenarioDuration(v)
+	return nil
+}
+
+// ScenarioError represents an invalid value in a scenario file
+type ScenarioError struct {
+	Key     string
+	Message string
+}
+
+// Error implements the error interface
+func (e *ScenarioError) Error() string {
+	if e.Key == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Key, e.Message)
+}
+
+// loadScenario reads and validates a JSON or YAML scenario file
+func loadScenario(path string) (*Scenario, error) {
+	var scenario Scenario
+	if err := decodeStructuredFile(path, &scenario); err != nil {
+		return nil, err
+	}
+	if err := scenario.validate(); err != nil {
+		return nil, err
+	}
+	return &scenario, nil
+}
+
+// loadURLEntries reads and validates a JSON or YAML list of URLs, in the
+// format of the urls of the scenario
+func loadURLEntries(path string) ([]simulator.URLEntry, error) {
+	var urls []ScenarioURL
+	if err := decodeStructuredFile(path, &urls); err != nil {
+		return nil, err
+	}
+	if len(urls) == 0 {
+		return nil, errors.New("no URL found")
+	}
+	if err := validateScenarioURLs(urls, ""); err != nil {
+		return nil, err
+	}
+
+	entries := make([]simulator.URLEntry, 0, len(urls))
+	for i, u := range urls {
+		entry, err := u.entry()
+		if err != nil {
+			return nil, &ScenarioError{fmt.Sprintf("[%d].body_file", i), err.Error()}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// decodeStructuredFile reads a JSON or YAML file, checks its keys and types
+// against v and decodes it into v
+func decodeStructuredFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// Convert YAML to JSON
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+	case ".yaml", ".yml":
+		if data, err = yamlToJSON(data, reflect.TypeOf(v).Elem()); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown format %q, expected .json, .yaml or .yml", filepath.Ext(path))
+	}
+
+	// Check the keys and the types first, to point to the offending key
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+	if err := checkScenarioValue(generic, reflect.TypeOf(v).Elem(), ""); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// checkScenarioValue checks that a decoded value matches the given type,
+// unknown keys and wrong types are reported with their full key
+func checkScenarioValue(v interface{}, t reflect.Type, key string) error {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if v == nil {
+		return nil
+	}
+
+	if t == reflect.TypeOf(ScenarioDuration(0)) {
+		s, ok := v.(string)
+		if !ok {
+			return &ScenarioError{key, "expected a duration like \"30s\""}
+		}
+		if _, err := time.ParseDuration(s); err != nil {
+			return &ScenarioError{key, fmt.Sprintf("invalid duration %q", s)}
+		}
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return &ScenarioError{key, "expected a mapping"}
+		}
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			fields[name] = t.Field(i).Type
+		}
+		for _, name := range slices.Sorted(maps.Keys(m)) {
+			fieldType, ok := fields[name]
+			if !ok {
+				return &ScenarioError{joinScenarioKey(key, name), "unknown key"}
+			}
+			if err := checkScenarioValue(m[name], fieldType, joinScenarioKey(key, name)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return &ScenarioError{key, "expected a mapping"}
+		}
+		for _, name := range slices.Sorted(maps.Keys(m)) {
+			if err := checkScenarioValue(m[name], t.Elem(), joinScenarioKey(key, name)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		s, ok := v.([]interface{})
+		if !ok {
+			return &ScenarioError{key, "expected a sequence"}
+		}
+		for i, e := range s {
+			if err := checkScenarioValue(e, t.Elem(), fmt.Sprintf("%s[%d]", key, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			return &ScenarioError{key, "expected a string"}
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			return &ScenarioError{key, "expected a boolean"}
+		}
+	case reflect.Int, reflect.Int64:
+		f, ok := v.(float64)
+		if !ok || f != math.Trunc(f) {
+			return &ScenarioError{key, "expected an integer"}
+		}
+	case reflect.Float64:
+		if _, ok := v.(float64); !ok {
+			return &ScenarioError{key, "expected a number"}
+		}
+	}
+	return nil
+}
+
+// joinScenarioKey returns the full key of a nested key
+func joinScenarioKey(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+// validate checks the values of the scenario
+func (s *Scenario) validate() error {
+	if s.Type != "" {
+		if !simulator.IsValidTrafficType(s.Type) {
+			return &ScenarioError{"type", fmt.Sprintf("invalid traffic type %q", s.Type)}
+		}
+	}
+	if s.Clients != nil && *s.Clients <= 0 {
+		return &ScenarioError{"clients", "must be positive"}
+	}
+	if s.Requests != nil && *s.Requests <= 0 {
+		return &ScenarioError{"requests", "must be positive"}
+	}
+	if s.Wait != nil && *s.Wait < 0 {
+		return &ScenarioError{"wait", "must not be negative"}
+	}
+	if s.WaitDist != "" {
+		if _, err := simulator.ParseThinkTime(s.WaitDist, 0); err != nil {
+			return &ScenarioError{"wait_distribution", err.Error()}
+		}
+	}
+	if s.Rate != nil && *s.Rate < 0 {
+		return &ScenarioError{"rate", "must not be negative"}
+	}
+	if s.ClientsProfile != "" && s.RateProfile != "" {
+		return &ScenarioError{"rate_profile", "can't be used with clients_profile"}
+	}
+	for key, spec := range map[string]string{"clients_profile": s.ClientsProfile, "rate_profile": s.RateProfile} {
+		if spec == "" {
+			continue
+		}
+		if _, err := simulator.ParseProfile(spec); err != nil {
+			return &ScenarioError{key, err.Error()}
+		}
+	}
+	if s.MaxInFlight != nil && *s.MaxInFlight < 0 {
+		return &ScenarioError{"max_in_flight", "must not be negative"}
+	}
+	if s.Duration != nil && *s.Duration < 0 {
+		return &ScenarioError{"duration", "must not be negative"}
+	}
+	if s.Drain != nil && *s.Drain < 0 {
+		return &ScenarioError{"drain", "must not be negative"}
+	}
+	if s.Timeout != nil && *s.Timeout <= 0 {
+		return &ScenarioError{"timeout", "must be positive"}
+	}
+	if s.Output.Interval != nil && *s.Output.Interval < 0 {
+		return &ScenarioError{"output.interval", "must not be negative"}
+	}
+	if _, err := simulator.ParseTLSVersion(s.TLS.MinVersion); err != nil {
+		return &ScenarioError{"tls.min_version", err.Error()}
+	}
+	if _, err := simulator.ParseTLSVersion(s.TLS.MaxVersion); err != nil {
+		return &ScenarioError{"tls.max_version", err.Error()}
+	}
+	if s.DNS.Transport != "" {
+		if err := simulator.CheckDNSOptions(s.DNS.Transport, "A"); err != nil {
+			return &ScenarioError{"dns.transport", err.Error()}
+		}
+	}
+	if s.DNS.RecordType != "" {
+		if err := simulator.CheckDNSOptions(simulator.UDPTransport, strings.ToUpper(s.DNS.RecordType)); err != nil {
+			return &ScenarioError{"dns.record_type", err.Error()}
+		}
+	}
+	if s.Connections != "" {
+		if err := simulator.CheckConnectionMode(s.Connections); err != nil {
+			return &ScenarioError{"connections", err.Error()}
+		}
+	}
+	if s.Method != "" && !simulator.IsValidMethod(s.Method) {
+		return &ScenarioError{"method", fmt.Sprintf("invalid method %q", s.Method)}
+	}
+	if s.Body != "" && s.BodyFile != "" {
+		return &ScenarioError{"body_file", "can't be used with body"}
+	}
+	for i, expr := range s.Thresholds {
+		if _, err := simulator.ParseThreshold(expr); err != nil {
+			return &ScenarioError{fmt.Sprintf("thresholds[%d]", i), err.Error()}
+		}
+	}
+	for i, expr := range s.AbortThreshold {
+		if _, err := simulator.ParseThreshold(expr); err != nil {
+			return &ScenarioError{fmt.Sprintf("abort_thresholds[%d]", i), err.Error()}
+		}
+	}
+	if s.AbortAfter != nil && *s.AbortAfter < 0 {
+		return &ScenarioError{"abort_after", "must not be negative"}
+	}
+	if s.URLSource != "" && len(s.URLs) > 0 {
+		return &ScenarioError{"urls", "can't be used with url_source"}
+	}
+
+	if len(s.URLs) > 0 {
+		return validateScenarioURLs(s.URLs, "urls")
+	}
+	return nil
+}
+
+// validateScenarioURLs checks the values of a list of URLs found under the
+// given key
+func validateScenarioURLs(urls []ScenarioURL, key string) error {
+	var totalWeight float64
+	for i, u := range urls {
+		itemKey := fmt.Sprintf("%s[%d]", key, i)
+		if u.URL == "" {
+			return &ScenarioError{itemKey + ".url", "is required"}
+		}
+		if _, err := url.Parse(simulator.NormalizeURL(u.URL)); err != nil {
+			return &ScenarioError{itemKey + ".url", fmt.Sprintf("invalid URL %q", u.URL)}
+		}
+		if u.Weight != nil && *u.Weight < 0 {
+			return &ScenarioError{itemKey + ".weight", "must not be negative"}
+		}
+		if u.Body != "" && u.BodyFile != "" {
+			return &ScenarioError{itemKey + ".body_file", "can't be used with body"}
+		}
+		if u.Method != "" && !simulator.IsValidMethod(u.Method) {
+			return &ScenarioError{itemKey + ".method", fmt.Sprintf("invalid method %q", u.Method)}
+		}
+		for j, code := range u.ExpectedStatus {
+			if !simulator.IsValidStatus(code) {
+				return &ScenarioError{fmt.Sprintf("%s.expected_status[%d]", itemKey, j), fmt.Sprintf("invalid status %d", code)}
+			}
+		}
+		if _, err := regexp.Compile(u.ExpectedRegex); err != nil {
+			return &ScenarioError{itemKey + ".expected_body_regex", err.Error()}
+		}
+		for j, raw := range u.ExpectedJSON {
+			if _, err := simulator.ParseJSONAssertion(raw); err != nil {
+				return &ScenarioError{fmt.Sprintf("%s.expected_json[%d]", itemKey, j), err.Error()}
+			}
+		}
+		if u.MaxBodySize < 0 {
+			return &ScenarioError{itemKey + ".max_body_size", "must not be negative"}
+		}
+		totalWeight += u.weight()
+	}
+	if totalWeight == 0 {
+		return &ScenarioError{key, "at least one weight must be positive"}
+	}
+	return nil
+}
+
+// weight returns the weight of the URL, 1 by default
+func (u ScenarioURL) weight() float64 {
+	if u.Weight == nil {
+		return 1
+	}
+	return *u.Weight
+}
+
+// entry returns the simulator.URLEntry of the URL, with the content of its body file
+func (u ScenarioURL) entry() (simulator.URLEntry, error) {
+	entry := simulator.URLEntry{
+		URL:            u.URL,
+		Weight:         u.weight(),
+		Method:         strings.ToUpper(u.Method),
+		Headers:        u.Headers,
+		Body:           u.Body,
+		ContentType:    u.ContentType,
+		ExpectedStatus: u.ExpectedStatus,
+		Assertions: simulator.Assertions{
+			BodyContains: u.ExpectedBody,
+			Headers:      u.ExpectedHeader,
+			MaxBodySize:  u.MaxBodySize,
+		},
+	}
+	// The assertions are checked by validate
+	if u.ExpectedRegex != "" {
+		entry.Assertions.BodyRegex = regexp.MustCompile(u.ExpectedRegex)
+	}
+	for _, raw := range u.ExpectedJSON {
+		j, _ := simulator.ParseJSONAssertion(raw)
+		entry.Assertions.JSON = append(entry.Assertions.JSON, j)
+	}
+	if u.BodyFile != "" {
+		b, contentType, err := simulator.ReadBodyFile(u.BodyFile)
+		if err != nil {
+			return entry, err
+		}
+		entry.Body = b
+		if entry.ContentType == "" {
+			entry.ContentType = contentType
+		}
+	}
+	return entry, nil
+}
+
+// apply sets the values of the scenario on the flags of the flag set, except
+// the ones given on the command line
+func (s *Scenario) apply(fs *flag.FlagSet) error {
+	values := map[string]string{}
+	if s.Type != "" {
+		values["type"] = s.Type
+	}
+	if s.Clients != nil {
+		values["clients"] = strconv.Itoa(*s.Clients)
+	}
+	if s.Requests != nil {
+		values["requests"] = strconv.Itoa(*s.Requests)
+	}
+	if s.Wait != nil {
+		values["wait"] = strconv.Itoa(*s.Wait)
+	}
+	if s.WaitDist != "" {
+		values["waitDistribution"] = s.WaitDist
+	}
+	if s.Rate != nil {
+		values["rate"] = strconv.FormatFloat(*s.Rate, 'g', -1, 64)
+	}
+	if s.ClientsProfile != "" {
+		values["clientsProfile"] = s.ClientsProfile
+	}
+	if s.RateProfile != "" {
+		values["rateProfile"] = s.RateProfile
+	}
+	if s.MaxInFlight != nil {
+		values["maxInFlight"] = strconv.Itoa(*s.MaxInFlight)
+	}
+	if s.Duration != nil {
+		values["duration"] = time.Duration(*s.Duration).String()
+	}
+	if s.Drain != nil {
+		values["drain"] = time.Duration(*s.Drain).String()
+	}
+	if s.Timeout != nil {
+		values["timeout"] = strconv.Itoa(*s.Timeout)
+	}
+	if s.FollowRedirect != nil {
+		values["followRedirect"] = strconv.FormatBool(*s.FollowRedirect)
+	}
+	if s.Connections != "" {
+		values["connections"] = s.Connections
+	}
+	if s.Method != "" {
+		values["method"] = s.Method
+	}
+	if s.Body != "" {
+		values["body"] = s.Body
+	}
+	if s.BodyFile != "" {
+		values["bodyFile"] = s.BodyFile
+	}
+	if s.ContentType != "" {
+		values["contentType"] = s.ContentType
+	}
+	if s.DataFile != "" {
+		values["dataFile"] = s.DataFile
+	}
+	if s.Seed != nil {
+		values["seed"] = strconv.FormatInt(*s.Seed, 10)
+	}
+	if s.URLSource != "" {
+		values["urlSource"] = s.URLSource
+	}
+	if s.TLS.Insecure != nil {
+		values["insecure"] = strconv.FormatBool(*s.TLS.Insecure)
+	}
+	if s.TLS.CAFile != "" {
+		values["caFile"] = s.TLS.CAFile
+	}
+	if s.TLS.CertFile != "" {
+		values["certFile"] = s.TLS.CertFile
+	}
+	if s.TLS.KeyFile != "" {
+		values["keyFile"] = s.TLS.KeyFile
+	}
+	if s.TLS.ServerName != "" {
+		values["serverName"] = s.TLS.ServerName
+	}
+	if s.TLS.MinVersion != "" {
+		values["tlsMinVersion"] = s.TLS.MinVersion
+	}
+	if s.TLS.MaxVersion != "" {
+		values["tlsMaxVersion"] = s.TLS.MaxVersion
+	}
+	if s.DNS.Server != "" {
+		values["dnsServer"] = s.DNS.Server
+	}
+	if s.DNS.Transport != "" {
+		values["dnsTransport"] = s.DNS.Transport
+	}
+	if s.DNS.RecordType != "" {
+		values["recordType"] = s.DNS.RecordType
+	}
+	if s.DNS.DoHMethod != "" {
+		values["dohMethod"] = s.DNS.DoHMethod
+	}
+	if s.AbortAfter != nil {
+		values["abortAfter"] = time.Duration(*s.AbortAfter).String()
+	}
+	if s.Output.Summary != "" {
+		values["output"] = s.Output.Summary
+	}
+	if s.Output.EventLog != "" {
+		values["eventLog"] = s.Output.EventLog
+	}
+	if s.Output.MetricsAddr != "" {
+		values["metricsAddr"] = s.Output.MetricsAddr
+	}
+	if s.Output.Interval != nil {
+		values["interval"] = time.Duration(*s.Output.Interval).String()
+	}
+
+	// Flags override the scenario
+	setFlags := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	// The body flags override both body keys
+	if setFlags["body"] || setFlags["bodyFile"] {
+		delete(values, "body")
+		delete(values, "bodyFile")
+	}
+	for name, value := range values {
+		if setFlags[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return err
+		}
+	}
+
+	for i, u := range s.URLs {
+		entry, err := u.entry()
+		if err != nil {
+			return &ScenarioError{fmt.Sprintf("urls[%d].body_file", i), err.Error()}
+		}
+		scenarioURLs = append(scenarioURLs, entry)
+	}
+	// The thresholds of the scenario are checked on top of the -threshold
+	// ones
+	for _, expr := range s.Thresholds {
+		t, _ := simulator.ParseThreshold(expr)
+		thresholds = append(thresholds, t)
+	}
+	for _, expr := range s.AbortThreshold {
+		t, _ := simulator.ParseThreshold(expr)
+		t.Abort = true
+		thresholds = append(thresholds, t)
+	}
+	// The -header flags override the headers of the scenario
+	for key, value := range s.Headers {
+		if _, ok := headers[http.CanonicalHeaderKey(key)]; !ok {
+			headers[http.CanonicalHeaderKey(key)] = value
+		}
+	}
+	// The -param flags override the parameters of the scenario
+	for key, value := range s.Params {
+		if _, ok := params[key]; !ok {
+			params[key] = value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PouuleT/traffic-simulator/simulator"
+)
+
+// newTestFlags resets the values of the flags and returns a new flag set
+// defining them, as the command line does
+func newTestFlags(t *testing.T, args ...string) *flag.FlagSet {
+	t.Helper()
+	headers = map[string]string{}
+	params = map[string]string{}
+	thresholds = nil
+	scenarioURLs = nil
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	registerFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+// writeScenario writes a scenario file with the given name and content
+func writeScenario(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadScenario(t *testing.T) {
+	yamlPath := writeScenario(t, "scenario.yaml", `
+type: http2
+clients: 20
+rate: 50
+duration: 5m
+connections: worker
+headers:
+  User-Agent: traffic-simulator
+urls:
+  - url: example.com
+    weight: 70
+  - url: example.com/checkout
+    method: POST
+    expected_status: [200, 201]
+tls:
+  min_version: 1.2
+thresholds: ["p99<300ms"]
+`)
+	jsonPath := writeScenario(t, "scenario.json", `{
+  "type": "http2", "clients": 20, "rate": 50, "duration": "5m", "connections": "worker",
+  "headers": {"User-Agent": "traffic-simulator"},
+  "urls": [{"url": "example.com", "weight": 70}, {"url": "example.com/checkout", "method": "POST", "expected_status": [200, 201]}],
+  "tls": {"min_version": "1.2"}, "thresholds": ["p99<300ms"]
+}`)
+	for _, path := range []string{yamlPath, jsonPath} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			s, err := loadScenario(path)
+			if err != nil {
+				t.Fatalf("loadScenario() error = %s", err)
+			}
+			if s.Type != "http2" || *s.Clients != 20 || *s.Rate != 50 || time.Duration(*s.Duration) != 5*time.Minute {
+				t.Errorf("unexpected run values: %+v", s)
+			}
+			if s.TLS.MinVersion != "1.2" {
+				t.Errorf("tls.min_version = %q, want \"1.2\"", s.TLS.MinVersion)
+			}
+			if len(s.URLs) != 2 || *s.URLs[0].Weight != 70 || s.URLs[1].Method != "POST" {
+				t.Errorf("unexpected urls: %+v", s.URLs)
+			}
+		})
+	}
+}
+
+func TestLoadScenarioErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unknown key", "clientz: 3\n", "clientz: unknown key"},
+		{"unknown nested key", "tls:\n  min: 1.2\n", "tls.min: unknown key"},
+		{"wrong type", "clients: many\n", "clients: expected an integer"},
+		{"fractional integer", "clients: 1.5\n", "clients: expected an integer"},
+		{"invalid duration", "duration: 30\n", "duration: expected a duration"},
+		{"negative drain", "drain: -1s\n", "drain: must not be negative"},
+		{"invalid type", "type: ftp\n", "type: invalid traffic type"},
+		{"invalid TLS version", "tls:\n  min_version: 1.4\n", "tls.min_version"},
+		{"invalid connections", "connections: pooled\n", "connections"},
+		{"invalid threshold", "thresholds: [\"p99\"]\n", "thresholds[0]"},
+		{"missing url", "urls:\n  - weight: 1\n", "urls[0].url: is required"},
+		{"both profiles", "clients_profile: hold:1:1s\nrate_profile: hold:1:1s\n", "rate_profile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadScenario(writeScenario(t, "scenario.yaml", tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadScenario() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyScenario(t *testing.T) {
+	s, err := loadScenario(writeScenario(t, "scenario.yaml", `
+clients: 20
+timeout: 7
+connections: worker
+headers:
+  X-Source: scenario
+  X-Flag: scenario
+params:
+  port: 443
+  mode: scenario
+thresholds: ["p99<300ms"]
+abort_thresholds: ["error_rate<50%"]
+urls:
+  - url: example.com
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := newTestFlags(t, "-clients", "5", "-header", "X-Flag: flag", "-param", "mode=flag")
+	if err := s.apply(fs); err != nil {
+		t.Fatalf("apply() error = %s", err)
+	}
+	resetConnectionMode(fs)
+
+	if nbOfClients != 5 {
+		t.Errorf("clients = %d, want the flag value 5", nbOfClients)
+	}
+	if timeout != 7 {
+		t.Errorf("timeout = %d, want the scenario value 7", timeout)
+	}
+	if connectionMode != simulator.WorkerConnections {
+		t.Errorf("connections = %q, want the scenario value to survive the reset", connectionMode)
+	}
+	if headers["X-Source"] != "scenario" || headers["X-Flag"] != "flag" {
+		t.Errorf("headers = %v, want the flags to override the scenario", headers)
+	}
+	if params["port"] != "443" || params["mode"] != "flag" {
+		t.Errorf("params = %v, want the flags to override the scenario", params)
+	}
+	if len(thresholds) != 2 || thresholds[0].Abort || !thresholds[1].Abort {
+		t.Errorf("thresholds = %v, want one threshold and one abort threshold", thresholds)
+	}
+	if len(scenarioURLs) != 1 || scenarioURLs[0].URL != "example.com" {
+		t.Errorf("urls = %+v, want the URL of the scenario", scenarioURLs)
+	}
+}
+
+func TestResetConnectionMode(t *testing.T) {
+	fs := newTestFlags(t)
+	resetConnectionMode(fs)
+	if connectionMode != "" {
+		t.Errorf("connections = %q, want it left to the traffic type", connectionMode)
+	}
+
+	fs = newTestFlags(t, "-connections", simulator.SharedConnections)
+	resetConnectionMode(fs)
+	if connectionMode != simulator.SharedConnections {
+		t.Errorf("connections = %q, want the flag value", connectionMode)
+	}
+}
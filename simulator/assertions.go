@@ -0,0 +1,120 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Assertions represents the checks of the responses of an URL, on top of
+// their expected status
+type Assertions struct {
+	BodyContains string
+	BodyRegex    *regexp.Regexp
+	JSON         []JSONAssertion
+	Headers      []string
+	MaxBodySize  int64
+}
+
+// JSONAssertion represents the check of a value of a JSON body, written as
+// "path" to check its presence or "path=value"
+type JSONAssertion struct {
+	Path  string
+	Value string
+	// AnyValue is true if only the presence of the path is checked
+	AnyValue bool
+}
+
+// ParseJSONAssertion parses a JSON assertion like "data.items.0.id=42", the
+// path is made of the keys of the objects and the indexes of the arrays
+func ParseJSONAssertion(s string) (JSONAssertion, error) {
+	path, value, ok := strings.Cut(s, "=")
+	if path == "" {
+		return JSONAssertion{}, fmt.Errorf("invalid JSON assertion %q, expected path or path=value", s)
+	}
+	return JSONAssertion{Path: path, Value: value, AnyValue: !ok}, nil
+}
+
+// needsBody returns true if the body of the responses must be kept to be
+// checked
+func (a *Assertions) needsBody() bool {
+	return a.BodyContains != "" || a.BodyRegex != nil || len(a.JSON) > 0
+}
+
+// check returns the reason why the response fails the assertions, or an empty
+// string if it passes them
+func (a *Assertions) check(resp *http.Response, body []byte, size int64) string {
+	if a.MaxBodySize > 0 && size > a.MaxBodySize {
+		return fmt.Sprintf("body larger than %s", humanize.Bytes(uint64(a.MaxBodySize)))
+	}
+	for _, name := range a.Headers {
+		if resp.Header.Get(name) == "" {
+			return fmt.Sprintf("header %s missing", http.CanonicalHeaderKey(name))
+		}
+	}
+	if a.BodyContains != "" && !bytes.Contains(body, []byte(a.BodyContains)) {
+		return fmt.Sprintf("body without \"%s\"", a.BodyContains)
+	}
+	if a.BodyRegex != nil && !a.BodyRegex.Match(body) {
+		return fmt.Sprintf("body not matching \"%s\"", a.BodyRegex.String())
+	}
+	if len(a.JSON) == 0 {
+		return ""
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "body not JSON"
+	}
+	for _, j := range a.JSON {
+		value, ok := jsonPathValue(v, j.Path)
+		if !ok {
+			return fmt.Sprintf("JSON %s missing", j.Path)
+		}
+		if !j.AnyValue && value != j.Value {
+			return fmt.Sprintf("JSON %s not %q", j.Path, j.Value)
+		}
+	}
+	return ""
+}
+
+// jsonPathValue returns the value at the path of a decoded JSON document, the
+// strings are returned unquoted and the other values as written in JSON
+func jsonPathValue(v interface{}, path string) (string, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch e := v.(type) {
+		case map[string]interface{}:
+			child, ok := e[key]
+			if !ok {
+				return "", false
+			}
+			v = child
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(e) {
+				return "", false
+			}
+			v = e[i]
+		default:
+			return "", false
+		}
+	}
+
+	switch e := v.(type) {
+	case string:
+		return e, true
+	case json.Number:
+		return e.String(), true
+	default:
+		b, _ := json.Marshal(e)
+		return string(b), true
+	}
+}
@@ -0,0 +1,107 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+func TestParseJSONAssertion(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    JSONAssertion
+		wantErr bool
+	}{
+		{"data.id", JSONAssertion{Path: "data.id", AnyValue: true}, false},
+		{"data.id=42", JSONAssertion{Path: "data.id", Value: "42"}, false},
+		{"data.id=", JSONAssertion{Path: "data.id"}, false},
+		{"url=a=b", JSONAssertion{Path: "url", Value: "a=b"}, false},
+		{"", JSONAssertion{}, true},
+		{"=42", JSONAssertion{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseJSONAssertion(tt.s)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseJSONAssertion() = %+v, %v, want %+v and an error %t", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJSONPathValue(t *testing.T) {
+	const doc = `{"data": {"items": [{"id": 42, "name": "cart"}, {"id": 1.50}], "ok": true, "none": null, "tags": ["a"], "big": 12345678901234567890}}`
+	dec := json.NewDecoder(bytes.NewReader([]byte(doc)))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{"data.items.0.id", "42", true},
+		{"data.items.0.name", "cart", true},
+		{"data.items.1.id", "1.50", true},
+		{"data.big", "12345678901234567890", true},
+		{"data.ok", "true", true},
+		{"data.none", "null", true},
+		{"data.tags", `["a"]`, true},
+		{"data.items.1", `{"id":1.50}`, true},
+		{"data.missing", "", false},
+		{"data.items.2.id", "", false},
+		{"data.items.-1", "", false},
+		{"data.items.first", "", false},
+		{"data.ok.value", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := jsonPathValue(v, tt.path)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("jsonPathValue() = %q, %t, want %q, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestAssertionsCheck(t *testing.T) {
+	resp := &http.Response{Header: http.Header{"X-Request-Id": []string{"abc"}}}
+	body := []byte(`{"status": "ok", "items": [{"id": 42}]}`)
+
+	tests := []struct {
+		name       string
+		assertions Assertions
+		body       []byte
+		want       string
+	}{
+		{"none", Assertions{}, body, ""},
+		{"all passing", Assertions{
+			BodyContains: `"ok"`,
+			BodyRegex:    regexp.MustCompile(`"id": \d+`),
+			JSON:         []JSONAssertion{{Path: "status", Value: "ok"}, {Path: "items.0.id", AnyValue: true}},
+			Headers:      []string{"x-request-id"},
+			MaxBodySize:  1000,
+		}, body, ""},
+		{"body too large", Assertions{MaxBodySize: 10}, body, "body larger than 10 B"},
+		{"header missing", Assertions{Headers: []string{"X-Request-Id", "x-trace-id"}}, body, "header X-Trace-Id missing"},
+		{"body without text", Assertions{BodyContains: "error"}, body, `body without "error"`},
+		{"body not matching", Assertions{BodyRegex: regexp.MustCompile(`^\[`)}, body, `body not matching "^\["`},
+		{"body not JSON", Assertions{JSON: []JSONAssertion{{Path: "status", AnyValue: true}}}, []byte("<html>"), "body not JSON"},
+		{"JSON missing", Assertions{JSON: []JSONAssertion{{Path: "items.1.id", AnyValue: true}}}, body, "JSON items.1.id missing"},
+		{"JSON value", Assertions{JSON: []JSONAssertion{{Path: "items.0.id", Value: "43"}}}, body, `JSON items.0.id not "43"`},
+		// The first failing assertion is returned
+		{"first failure", Assertions{MaxBodySize: 10, BodyContains: "error"}, body, "body larger than 10 B"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.assertions.check(resp, tt.body, int64(len(tt.body))); got != tt.want {
+				t.Errorf("check() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
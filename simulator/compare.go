@@ -0,0 +1,76 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// Compare renders the results of the run next to the ones of a previous run
+// written in JSON with -output, like an http run to compare with http2
+func (trafficGen *TrafficGenerator) Compare(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var baseline Summary
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return fmt.Errorf("invalid JSON summary: %s", err)
+	}
+	if baseline.Version != summaryVersion {
+		return fmt.Errorf("unsupported summary version %d, expected %d", baseline.Version, summaryVersion)
+	}
+	current := trafficGen.Summary()
+	out := trafficGen.opts.output()
+
+	table := tablewriter.NewWriter(out)
+	table.SetAlignment(tablewriter.ALIGN_CENTER)
+	table.SetHeader([]string{"", "Baseline", "This run", "Change"})
+	table.Append([]string{"Type", baseline.Type, current.Type, ""})
+	table.Append([]string{
+		"Number of requests",
+		strconv.Itoa(baseline.Requests),
+		strconv.Itoa(current.Requests),
+		"",
+	})
+	baseRate, currentRate := requestRate(&baseline), requestRate(current)
+	table.Append([]string{
+		"Req/s",
+		fmt.Sprintf("%.1f", baseRate),
+		fmt.Sprintf("%.1f", currentRate),
+		change(baseRate, currentRate),
+	})
+	table.Append(durationRow("Average duration", baseline.AvgDuration, current.AvgDuration))
+	for _, name := range percentileHeaders() {
+		table.Append(durationRow(name, baseline.Percentiles[name], current.Percentiles[name]))
+	}
+
+	fmt.Fprintf(out, "\nComparison with %s :\n", path)
+	table.Render()
+	return nil
+}
+
+// requestRate returns the number of requests per second of a run
+func requestRate(s *Summary) float64 {
+	if s.ExecDuration <= 0 {
+		return 0
+	}
+	return float64(s.Requests) / s.ExecDuration.Seconds()
+}
+
+// durationRow returns a row of the comparison for a duration
+func durationRow(name string, baseline, current time.Duration) []string {
+	return []string{name, baseline.String(), current.String(), change(float64(baseline), float64(current))}
+}
+
+// change returns the relative change from the baseline, like "-12.5%"
+func change(baseline, current float64) string {
+	if baseline == 0 {
+		return "NaN"
+	}
+	return fmt.Sprintf("%+.1f%%", (current-baseline)/baseline*100)
+}
@@ -0,0 +1,175 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"time"
+)
+
+// Encrypted DNS traffic types
+const (
+	// DoHTraffic sends the queries over HTTPS, as in RFC 8484
+	DoHTraffic = "doh"
+	// DoTTraffic sends the queries over TLS, as in RFC 7858
+	DoTTraffic = "dot"
+)
+
+// dnsMessageType is the media type of the DNS messages sent over HTTPS
+const dnsMessageType = "application/dns-message"
+
+// dotPort is the port of DNS over TLS, used when the DNS server has none
+const dotPort = "853"
+
+// configureDoH returns an error if the options of the DNS over HTTPS
+// queries are invalid
+func configureDoH(o *Options) error {
+	if !strings.HasPrefix(o.DNS.Server, "https://") && !strings.HasPrefix(o.DNS.Server, "http://") {
+		return fmt.Errorf("the %s type needs the URL of the DNS server, like https://dns.example/dns-query", o.Type)
+	}
+	if o.DNS.DoHMethod != http.MethodGet && o.DNS.DoHMethod != http.MethodPost {
+		return fmt.Errorf("unknown DoH method %q, expected GET or POST", o.DNS.DoHMethod)
+	}
+	return nil
+}
+
+// configureDoT returns an error if the options of the DNS over TLS queries
+// are invalid, and adds the default port to the DNS server
+func configureDoT(o *Options) error {
+	if o.DNS.Server == "" {
+		return fmt.Errorf("the %s type needs the address of the DNS server", o.Type)
+	}
+	if _, _, err := net.SplitHostPort(o.DNS.Server); err != nil {
+		o.DNS.Server = net.JoinHostPort(o.DNS.Server, dotPort)
+	}
+	return nil
+}
+
+// lookupDoT sends a query for the URL to the DNS server over a new TLS
+// connection and returns a Request, it is aborted if the context is canceled
+func lookupDoT(ctx context.Context, entry *URLEntry, w *Worker, vars *RequestVars) Request {
+	opts := w.Options()
+	id := uint16(lastDNSID.Add(1))
+	r, query := newRawDNSRequest(hostname(vars.expand(entry.URL)), id, opts.DNS.RecordType)
+	if r.err != nil {
+		return r
+	}
+
+	deadline := r.start.Add(opts.Timeout)
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Deadline: deadline},
+		Config:    w.TLSConfig(),
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", opts.DNS.Server)
+	if err != nil {
+		r.done(ctx, nil, id, err)
+		return r
+	}
+	defer conn.Close()
+	handshake := time.Since(r.start)
+
+	if err := conn.SetDeadline(deadline); err != nil {
+		r.done(ctx, nil, id, err)
+		return r
+	}
+	stop := abortOnCancel(ctx, conn)
+	defer stop()
+	msg, err := exchangeDNSStream(conn, query)
+	r.done(ctx, msg, id, err)
+	if r.err == nil {
+		r.phases = []timelinePhase{
+			{"Handshake", handshake},
+			{"Query", r.duration - handshake},
+		}
+	}
+	return r
+}
+
+// lookupDoH sends a query for the URL to the DNS server over HTTPS, with the
+// connections of the worker, and returns a Request, it is aborted if the
+// context is canceled
+func lookupDoH(ctx context.Context, entry *URLEntry, w *Worker, vars *RequestVars) Request {
+	opts := w.Options()
+	// The id is 0 for the responses to be cached, as advised by RFC 8484
+	r, query := newRawDNSRequest(hostname(vars.expand(entry.URL)), 0, opts.DNS.RecordType)
+	if r.err != nil {
+		return r
+	}
+
+	server := opts.DNS.Server
+	var req *http.Request
+	var err error
+	if opts.DNS.DoHMethod == http.MethodGet {
+		sep := "?"
+		if strings.Contains(server, "?") {
+			sep = "&"
+		}
+		req, err = http.NewRequest(http.MethodGet, server+sep+"dns="+base64.RawURLEncoding.EncodeToString(query), nil)
+	} else {
+		req, err = http.NewRequest(http.MethodPost, server, bytes.NewReader(query))
+		if err == nil {
+			req.Header.Set("Content-Type", dnsMessageType)
+		}
+	}
+	if err != nil {
+		r.done(ctx, nil, 0, err)
+		return r
+	}
+	req.Header.Set("Accept", dnsMessageType)
+
+	// The handshake lasts until the connection is ready, it is skipped on a
+	// reused connection
+	var gotConn time.Time
+	trace := &httptrace.ClientTrace{
+		GotConn: func(_ httptrace.GotConnInfo) { gotConn = time.Now() },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+
+	client, done := w.HTTPClient()
+	defer done()
+
+	msg, err := doDoH(client, req)
+	r.done(ctx, msg, 0, err)
+	if r.err == nil {
+		handshake := between(r.start, gotConn)
+		r.phases = []timelinePhase{
+			{"Handshake", handshake},
+			{"Query", r.duration - handshake},
+		}
+	}
+	return r
+}
+
+// doDoH makes the HTTP request of a query and returns the DNS response
+func doDoH(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != dnsMessageType {
+		return nil, fmt.Errorf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+	// A DNS message is at most 65535 bytes long
+	msg, err := io.ReadAll(io.LimitReader(resp.Body, 65536))
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) > 65535 {
+		return nil, errors.New("malformed DNS message: too long")
+	}
+	return msg, nil
+}
@@ -0,0 +1,252 @@
+package simulator
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDNSStub answers the queries like a resolver: the names starting with
+// "nx." don't exist, the other ones have an address
+func testDNSStub(t *testing.T, query []byte, id uint16) []byte {
+	t.Helper()
+	if len(query) < dnsHeaderSize {
+		t.Errorf("query of %d bytes, want at least a header", len(query))
+		return nil
+	}
+	if got := binary.BigEndian.Uint16(query); got != id {
+		t.Errorf("query id = %d, want %d", got, id)
+	}
+	if flags := binary.BigEndian.Uint16(query[2:]); flags != 0x0100 {
+		t.Errorf("query flags = %#04x, want recursion desired", flags)
+	}
+	if questions := binary.BigEndian.Uint16(query[4:]); questions != 1 {
+		t.Errorf("query with %d questions, want 1", questions)
+	}
+
+	// Read the name of the question, which is never compressed
+	var labels []string
+	offset := dnsHeaderSize
+	for offset < len(query) && query[offset] != 0 {
+		length := int(query[offset])
+		if offset+1+length > len(query) {
+			break
+		}
+		labels = append(labels, string(query[offset+1:offset+1+length]))
+		offset += 1 + length
+	}
+	if offset+5 != len(query) {
+		t.Errorf("query of %d bytes, want it to end after the question", len(query))
+		return nil
+	}
+	if qtype := binary.BigEndian.Uint16(query[offset+1:]); qtype != dnsTypes["A"] {
+		t.Errorf("query type = %d, want A", qtype)
+	}
+
+	if strings.HasPrefix(strings.Join(labels, "."), "nx.") {
+		return testDNSResponse(query, 3)
+	}
+	return testDNSResponse(query, 0, testDNSAnswer([4]byte{10, 0, 0, 1}))
+}
+
+// testCertificate returns a self-signed certificate for 127.0.0.1
+func testCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// testLookup makes a query for the name with a generator of the traffic type
+func testLookup(t *testing.T, trafficType, server, method, name string) *DNSRequest {
+	t.Helper()
+	opts := DefaultOptions()
+	opts.Type = trafficType
+	opts.Clients = 1
+	opts.Requests = 1
+	opts.DNS.Server = server
+	opts.DNS.DoHMethod = method
+	opts.TLS.Insecure = true
+	trafficGen, err := NewTrafficGenerator(opts)
+	if err != nil {
+		t.Fatalf("NewTrafficGenerator() error = %s", err)
+	}
+	w := trafficGen.NewWorker(1)
+	entry := &URLEntry{URL: name, Weight: 1}
+	vars := &RequestVars{templates: trafficGen.templates}
+	r, ok := trafficGen.trafficType.Do(context.Background(), entry, w, vars).(*DNSRequest)
+	if !ok {
+		t.Fatalf("the %s traffic type doesn't return a DNS request", trafficType)
+	}
+	return r
+}
+
+func TestDoH(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if got := req.Header.Get("Accept"); got != dnsMessageType {
+			t.Errorf("Accept = %q, want %q", got, dnsMessageType)
+		}
+		var query []byte
+		var err error
+		switch req.Method {
+		case http.MethodGet:
+			// The query is encoded in base64url without padding
+			param := req.URL.Query().Get("dns")
+			if strings.ContainsAny(param, "+/=") {
+				t.Errorf("dns parameter %q is not base64url without padding", param)
+			}
+			query, err = base64.RawURLEncoding.DecodeString(param)
+		case http.MethodPost:
+			if got := req.Header.Get("Content-Type"); got != dnsMessageType {
+				t.Errorf("Content-Type = %q, want %q", got, dnsMessageType)
+			}
+			query, err = io.ReadAll(req.Body)
+		default:
+			t.Errorf("unexpected method %s", req.Method)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch req.URL.Path {
+		case "/fail":
+			http.Error(w, "failure", http.StatusInternalServerError)
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write(testDNSStub(t, query, 0))
+		default:
+			w.Header().Set("Content-Type", dnsMessageType)
+			w.Write(testDNSStub(t, query, 0))
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name      string
+		path      string
+		host      string
+		status    string
+		criticity CriticityLevel
+		answers   int
+		err       string
+	}{
+		{"address", "/dns-query", "api.example.com", "NOERROR", Success, 1, ""},
+		{"query in the URL", "/dns-query?ct=1", "api.example.com", "NOERROR", Success, 1, ""},
+		{"nxdomain", "/dns-query", "nx.example.com", "NXDOMAIN", Warning, 0, ""},
+		{"HTTP error", "/fail", "api.example.com", "", Critical, 0, "unexpected HTTP status 500"},
+		{"content type", "/text", "api.example.com", "", Critical, 0, "unexpected content type"},
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		for _, tt := range tests {
+			t.Run(method+" "+tt.name, func(t *testing.T) {
+				r := testLookup(t, DoHTraffic, ts.URL+tt.path, method, tt.host)
+				if tt.err != "" {
+					if r.err == nil || !strings.Contains(r.err.Error(), tt.err) || r.criticity != tt.criticity {
+						t.Errorf("request = %s, want a %v error containing %q", r, tt.criticity, tt.err)
+					}
+					return
+				}
+				if r.err != nil {
+					t.Fatalf("request error = %s", r.err)
+				}
+				if r.status != tt.status || r.criticity != tt.criticity || r.response.answers != tt.answers {
+					t.Errorf("request = %s, want %s with %d answers", r, tt.status, tt.answers)
+				}
+			})
+		}
+	}
+}
+
+func TestDoT(t *testing.T) {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{testCertificate(t)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				// The query and the response are prefixed by their length
+				var length [2]byte
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					t.Errorf("reading the length of the query: %s", err)
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					t.Errorf("reading the query: %s", err)
+					return
+				}
+				resp := testDNSStub(t, query, binary.BigEndian.Uint16(query))
+				conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+			}()
+		}
+	}()
+
+	tests := []struct {
+		host      string
+		status    string
+		criticity CriticityLevel
+		answers   int
+	}{
+		{"api.example.com", "NOERROR", Success, 1},
+		{"nx.example.com", "NXDOMAIN", Warning, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			r := testLookup(t, DoTTraffic, l.Addr().String(), "", tt.host)
+			if r.err != nil {
+				t.Fatalf("request error = %s", r.err)
+			}
+			if r.status != tt.status || r.criticity != tt.criticity || r.response.answers != tt.answers {
+				t.Errorf("request = %s, want %s with %d answers", r, tt.status, tt.answers)
+			}
+			if len(r.phases) != 2 || r.phases[0].name != "Handshake" {
+				t.Errorf("phases = %v, want the handshake and the query", r.phases)
+			}
+		})
+	}
+
+	// The server has no port, the port of DNS over TLS is used
+	opts := DefaultOptions()
+	opts.Type = DoTTraffic
+	opts.DNS.Server = "127.0.0.1"
+	trafficGen, err := NewTrafficGenerator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := trafficGen.Options().DNS.Server; got != "127.0.0.1:853" {
+		t.Errorf("DNS server = %q, want the default port", got)
+	}
+}
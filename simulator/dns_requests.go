@@ -0,0 +1,218 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// DNSRequest represents a request response, with the return code and the duration
+type DNSRequest struct {
+	status    string
+	url       string
+	criticity CriticityLevel
+	start     time.Time
+	duration  time.Duration
+	err       error
+	// recordType and response are only set for the queries sent to
+	// the DNS server
+	recordType string
+	response   *dnsResponse
+	// phases holds the handshake and query times of the encrypted queries
+	phases []timelinePhase
+}
+
+// String will return the string representing the request
+func (r *DNSRequest) String() string {
+	query := "Get"
+	if r.recordType != "" {
+		query = r.recordType
+	}
+	if r.IsError() {
+		return fmt.Sprintf("| %s | %13s | %s %s : %s", errorLabel(r.criticity), r.duration, query, r.url, r.Error())
+	}
+	if r.response != nil {
+		return fmt.Sprintf("| %s | %13s | %s %s ( %d answers, %s%s )", criticityColor[r.criticity](r.status), r.duration, query, r.url, r.response.answers, humanize.Bytes(uint64(r.response.size)), truncatedMark(r.response.truncated))
+	}
+	return fmt.Sprintf("| %s | %13s | %s %s", criticityColor[r.criticity](r.status), r.duration, query, r.url)
+}
+
+// truncatedMark returns the mark of a truncated response in the logs
+func truncatedMark(truncated bool) string {
+	if truncated {
+		return ", truncated"
+	}
+	return ""
+}
+
+// Duration returns the duration of the request
+func (r DNSRequest) Duration() time.Duration {
+	return r.duration
+}
+
+// Criticity returns the criticity level of the request
+func (r DNSRequest) Criticity() CriticityLevel {
+	return r.criticity
+}
+
+// AddDelay adds the time spent waiting to be dispatched to the duration
+func (r *DNSRequest) AddDelay(d time.Duration) {
+	r.start = r.start.Add(-d)
+	r.duration += d
+}
+
+// Event returns the event representing the request
+func (r *DNSRequest) Event() *Event {
+	e := NewEvent(r.url, r.start, r.duration, r.criticity, r.err)
+	e.Status = strings.TrimSpace(r.status)
+	e.Size = r.Size()
+	e.RecordType = r.recordType
+	if len(r.phases) > 0 {
+		e.Timeline = map[string]time.Duration{}
+		for _, phase := range r.phases {
+			e.Timeline[phase.name] = phase.duration
+		}
+	}
+	if r.response != nil {
+		e.Answers = &r.response.answers
+		e.Truncated = &r.response.truncated
+	}
+	if r.err != nil {
+		e.Error = r.Error()
+	}
+	return e
+}
+
+// Error implements the error interface
+func (r DNSRequest) Error() string {
+	var errName string
+
+	switch e := r.err.(type) {
+	case *net.DNSError:
+		errName = "DNS lookup error"
+	case *net.DNSConfigError:
+		errName = "DNS config error"
+	case *net.AddrError:
+		errName = "Addr Error"
+	case *net.OpError:
+		errName = "Op Error"
+	case *url.Error:
+		if e.Timeout() {
+			errName = "URL Timeout"
+		} else {
+			errName = "URL Error"
+		}
+	case net.Error:
+		errName = "Net Error"
+	default:
+		errName = e.Error()
+	}
+	return errName
+}
+
+// Size returns the size of the response
+func (r DNSRequest) Size() int64 {
+	if r.response == nil {
+		return 0
+	}
+	return int64(r.response.size)
+}
+
+// Status returns the status of the request
+func (r DNSRequest) Status() string {
+	return r.status
+}
+
+// IsError returns true if the request is an error
+func (r DNSRequest) IsError() bool {
+	return r.err != nil
+}
+
+// lookupURL will make a DNS request on a given URL and return a Request, with
+// the system resolver or with a query sent to the DNS server, it is aborted if
+// the context is canceled
+func lookupURL(ctx context.Context, entry *URLEntry, w *Worker, vars *RequestVars) Request {
+	var dur time.Duration
+	url := hostname(vars.expand(entry.URL))
+	if w.Options().DNS.Server != "" {
+		return queryDNS(ctx, url, w.Options())
+	}
+	t := time.Now()
+	// Make the DNS request
+	_, err := net.DefaultResolver.LookupHost(ctx, url)
+	if err != nil {
+		dur = time.Since(t)
+		return &DNSRequest{
+			start:     t,
+			duration:  dur,
+			url:       url,
+			err:       err,
+			criticity: errorCriticity(ctx),
+		}
+	}
+
+	// Record the duration of the request
+	dur = time.Since(t)
+
+	return &DNSRequest{
+		start:     t,
+		duration:  dur,
+		status:    "OK ",
+		criticity: Success,
+		url:       url,
+	}
+}
+
+// queryDNS sends a query for the name to the DNS server and returns a Request
+func queryDNS(ctx context.Context, name string, opts *Options) Request {
+	id := uint16(lastDNSID.Add(1))
+	r, query := newRawDNSRequest(name, id, opts.DNS.RecordType)
+	if r.err != nil {
+		return r
+	}
+	msg, err := exchangeDNS(ctx, opts.DNS.Server, opts.DNS.Transport, query, r.start.Add(opts.Timeout))
+	r.done(ctx, msg, id, err)
+	return r
+}
+
+// newRawDNSRequest returns the request of a query for the records of the name
+// with the given type, and the query to send
+func newRawDNSRequest(name string, id uint16, recordType string) (*DNSRequest, []byte) {
+	r := &DNSRequest{
+		start:      time.Now(),
+		url:        name,
+		recordType: recordType,
+		criticity:  Critical,
+	}
+	query, err := newDNSQuery(id, name, dnsTypes[recordType])
+	if err != nil {
+		r.duration = time.Since(r.start)
+		r.err = err
+	}
+	return r, query
+}
+
+// done records the response to the query with the given id, or the error of
+// the exchange made with the context
+func (r *DNSRequest) done(ctx context.Context, msg []byte, id uint16, err error) {
+	if err == nil {
+		r.response, err = parseDNSResponse(msg, id)
+	}
+	r.duration = time.Since(r.start)
+	if err != nil {
+		r.err = err
+		r.criticity = errorCriticity(ctx)
+		return
+	}
+
+	r.status = r.response.rcodeName()
+	r.criticity = Success
+	if r.response.rcode != 0 {
+		r.criticity = Warning
+	}
+}
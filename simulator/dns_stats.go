@@ -0,0 +1,196 @@
+package simulator
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+)
+
+// DNSStats represents the stats of the requests
+type DNSStats struct {
+	DurationStats
+	ScheduleStats
+	sync.Mutex
+	opts         *Options
+	nbOfRequests int
+	statusStats  map[string]int
+	criticities  map[string]int
+	// serverErrors counts the warnings with a SERVFAIL status, they are
+	// errors
+	serverErrors int
+	// responses, answers, truncated and totalSize are only recorded for the
+	// queries sent to the DNS server
+	responses int
+	answers   int
+	truncated int
+	totalSize int64
+	// phases holds the steps of the encrypted queries in order, and
+	// phaseStats their durations
+	phases     []string
+	phaseStats map[string]*DurationStats
+}
+
+// NewDNSStats will return an empty Stats object
+func NewDNSStats(opts *Options) Stats {
+	return &DNSStats{
+		opts:          opts,
+		DurationStats: DurationStats{},
+		statusStats:   map[string]int{},
+		criticities:   map[string]int{},
+		phaseStats:    map[string]*DurationStats{},
+	}
+}
+
+// AddRequest will add a request to the stats
+func (s *DNSStats) AddRequest(req Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.nbOfRequests++
+	s.addDuration(req)
+	s.criticities[criticityName[req.Criticity()]]++
+	if r, ok := req.(*DNSRequest); ok && r.response != nil {
+		s.responses++
+		if r.response.rcodeName() == "SERVFAIL" && req.Criticity() == Warning {
+			s.serverErrors++
+		}
+		s.answers += r.response.answers
+		if r.response.truncated {
+			s.truncated++
+		}
+		s.totalSize += int64(r.response.size)
+	}
+	if r, ok := req.(*DNSRequest); ok {
+		for _, phase := range r.phases {
+			d, ok := s.phaseStats[phase.name]
+			if !ok {
+				d = &DurationStats{}
+				s.phaseStats[phase.name] = d
+				s.phases = append(s.phases, phase.name)
+			}
+			d.record(phase.duration)
+		}
+	}
+
+	if req.IsError() {
+		s.statusStats[req.Error()]++
+		return
+	}
+	s.statusStats[req.Status()]++
+}
+
+// addDuration will add the duration of a requests to the stats
+func (s *DNSStats) addDuration(req Request) {
+	s.record(req.Duration())
+}
+
+// Render renders the results
+func (s *DNSStats) Render() {
+	out := s.opts.output()
+	table := tablewriter.NewWriter(out)
+	table.SetAlignment(tablewriter.ALIGN_CENTER)
+	table.SetHeader([]string{
+		"Number of requests ",
+		"Min duration",
+		"Max duration",
+		"Average duration",
+		"Exec duration",
+	})
+	table.Append([]string{
+		strconv.Itoa(s.nbOfRequests),
+		s.minDuration.String(),
+		s.maxDuration.String(),
+		getAvgDuration(s.totalDuration, s.nbOfRequests),
+		s.execDuration.String(),
+	})
+
+	fmt.Fprintf(out, "\nStats :\n")
+	table.Render()
+
+	s.renderPercentiles(out)
+	s.histogram.Render(out, "Duration")
+
+	statusTable := tablewriter.NewWriter(out)
+	statusTable.SetAlignment(tablewriter.ALIGN_CENTER)
+	statusTable.SetHeader([]string{"Result", "Count"})
+	for key, value := range s.statusStats {
+		statusTable.Append([]string{key, strconv.Itoa(value)})
+	}
+
+	fmt.Fprintf(out, "\nStatuses :\n")
+	statusTable.Render()
+
+	if s.responses > 0 {
+		responseTable := tablewriter.NewWriter(out)
+		responseTable.SetAlignment(tablewriter.ALIGN_CENTER)
+		responseTable.SetHeader([]string{"Server", "Transport", "Record type", "Responses", "Avg answers", "Truncated", "Avg size", "Total size"})
+		responseTable.Append([]string{
+			s.opts.DNS.Server,
+			s.opts.dnsTransportName(),
+			s.opts.DNS.RecordType,
+			strconv.Itoa(s.responses),
+			fmt.Sprintf("%.1f", float64(s.answers)/float64(s.responses)),
+			strconv.Itoa(s.truncated),
+			humanize.Bytes(uint64(s.totalSize / int64(s.responses))),
+			humanize.Bytes(uint64(s.totalSize)),
+		})
+
+		fmt.Fprintf(out, "\nResponses :\n")
+		responseTable.Render()
+	}
+
+	if len(s.phases) > 0 {
+		timeTable := tablewriter.NewWriter(out)
+		timeTable.SetHeader(append([]string{"Step", "Average duration"}, percentileHeaders()...))
+		timeTable.SetAlignment(tablewriter.ALIGN_CENTER)
+		for _, name := range s.phases {
+			d := s.phaseStats[name]
+			timeTable.Append(append(
+				[]string{name, getAvgDuration(d.totalDuration, int(d.histogram.Count()))},
+				d.histogram.percentileRow()...,
+			))
+		}
+
+		fmt.Fprintf(out, "\nRequest details :\n")
+		timeTable.Render()
+	}
+
+	s.renderSchedule(out, s.opts.Rate)
+}
+
+// Summary returns the machine-readable results
+func (s *DNSStats) Summary() *Summary {
+	s.Lock()
+	defer s.Unlock()
+	summary := newSummary(&s.DurationStats, s.nbOfRequests, s.statusStats, s.criticities)
+	summary.Errors += s.serverErrors
+	summary.Schedule = s.summary(s.opts.Rate)
+	if s.responses > 0 {
+		summary.TotalSize = &s.totalSize
+		summary.DNS = &DNSSummary{
+			Responses: s.responses,
+			Answers:   s.answers,
+			Truncated: s.truncated,
+		}
+	}
+	if len(s.phases) > 0 {
+		summary.Timeline = map[string]StepSummary{}
+		for name, d := range s.phaseStats {
+			summary.Timeline[name] = StepSummary{
+				AvgDuration: avgDuration(d.totalDuration, int(d.histogram.Count())),
+				Percentiles: d.histogram.percentileMap(),
+			}
+		}
+	}
+	return summary
+}
+
+// SetDuration will set the total duration of the simulation
+func (s *DNSStats) SetDuration(t time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.execDuration = t
+}
@@ -0,0 +1,251 @@
+package simulator
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DNS transports of the queries sent to the DNS server
+const (
+	// UDPTransport sends each query in a UDP datagram
+	UDPTransport = "udp"
+	// TCPTransport sends each query on a TCP connection, prefixed by its
+	// length
+	TCPTransport = "tcp"
+)
+
+// dnsTypes holds the record types which can be queried
+var dnsTypes = map[string]uint16{
+	"A":     1,
+	"NS":    2,
+	"CNAME": 5,
+	"MX":    15,
+	"TXT":   16,
+	"AAAA":  28,
+	"SRV":   33,
+}
+
+// dnsRcodes holds the names of the response codes
+var dnsRcodes = map[int]string{
+	0: "NOERROR",
+	1: "FORMERR",
+	2: "SERVFAIL",
+	3: "NXDOMAIN",
+	4: "NOTIMP",
+	5: "REFUSED",
+}
+
+// dnsHeaderSize is the size of the header of a DNS message
+const dnsHeaderSize = 12
+
+// lastDNSID is the id of the last query, the ids only need to differ between
+// the queries in flight
+var lastDNSID atomic.Uint32
+
+// errDNSTruncated is returned when a message ends before its records
+var errDNSTruncated = errors.New("malformed DNS message: unexpected end")
+
+// dnsResponse represents what is recorded from a DNS response
+type dnsResponse struct {
+	rcode     int
+	answers   int
+	truncated bool
+	size      int
+}
+
+// rcodeName returns the name of the response code
+func (r *dnsResponse) rcodeName() string {
+	if name, ok := dnsRcodes[r.rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", r.rcode)
+}
+
+// CheckDNSOptions returns an error if the transport or the record type of the
+// DNS queries is unknown
+func CheckDNSOptions(transport, recordType string) error {
+	switch transport {
+	case UDPTransport, TCPTransport:
+	default:
+		return fmt.Errorf("unknown DNS transport %q, expected udp or tcp", transport)
+	}
+	if _, ok := dnsTypes[recordType]; !ok {
+		return fmt.Errorf("unknown record type %q, expected A, AAAA, MX, TXT, SRV, CNAME or NS", recordType)
+	}
+	return nil
+}
+
+// newDNSQuery returns a query for the name and the record type, with
+// recursion desired
+func newDNSQuery(id uint16, name string, qtype uint16) ([]byte, error) {
+	msg := make([]byte, dnsHeaderSize, dnsHeaderSize+len(name)+6)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	// Flags: recursion desired
+	binary.BigEndian.PutUint16(msg[2:], 0x0100)
+	// One question
+	binary.BigEndian.PutUint16(msg[4:], 1)
+
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("invalid DNS name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	// Class IN
+	msg = binary.BigEndian.AppendUint16(msg, 1)
+	if len(msg) > 512 {
+		return nil, fmt.Errorf("invalid DNS name %q: too long", name)
+	}
+	return msg, nil
+}
+
+// parseDNSResponse checks that the message answers the query with the given
+// id and returns what is recorded from it
+func parseDNSResponse(msg []byte, id uint16) (*dnsResponse, error) {
+	if len(msg) < dnsHeaderSize {
+		return nil, errDNSTruncated
+	}
+	if binary.BigEndian.Uint16(msg[0:]) != id {
+		return nil, errors.New("malformed DNS message: unexpected id")
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&0x8000 == 0 {
+		return nil, errors.New("malformed DNS message: not a response")
+	}
+	r := &dnsResponse{
+		rcode:     int(flags & 0x000f),
+		answers:   int(binary.BigEndian.Uint16(msg[6:])),
+		truncated: flags&0x0200 != 0,
+		size:      len(msg),
+	}
+
+	// Walk the questions and the answers to check the message, a truncated
+	// message may stop before its answers
+	offset := dnsHeaderSize
+	var err error
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[4:])); i++ {
+		if offset, err = skipDNSName(msg, offset); err != nil {
+			return nil, err
+		}
+		offset += 4
+	}
+	for i := 0; i < r.answers; i++ {
+		if offset, err = skipDNSName(msg, offset); err != nil {
+			break
+		}
+		if offset+10 > len(msg) {
+			err = errDNSTruncated
+			break
+		}
+		offset += 10 + int(binary.BigEndian.Uint16(msg[offset+8:]))
+	}
+	if (err != nil || offset > len(msg)) && !r.truncated {
+		if err == nil {
+			err = errDNSTruncated
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// skipDNSName returns the offset following the name at the given offset
+func skipDNSName(msg []byte, offset int) (int, error) {
+	start := offset
+	for {
+		if offset >= len(msg) {
+			return 0, errDNSTruncated
+		}
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			return offset + 1, nil
+		case length&0xc0 == 0xc0:
+			// A pointer ends the name, it must point to a previous name
+			// for the names to be read without loops
+			if offset+1 >= len(msg) {
+				return 0, errDNSTruncated
+			}
+			pointer := int(binary.BigEndian.Uint16(msg[offset:]) & 0x3fff)
+			if pointer < dnsHeaderSize || pointer >= start {
+				return 0, errors.New("malformed DNS message: invalid compression pointer")
+			}
+			return offset + 2, nil
+		case length&0xc0 != 0:
+			return 0, errors.New("malformed DNS message: unknown label type")
+		default:
+			offset += 1 + length
+		}
+	}
+}
+
+// exchangeDNS sends the query to the server with the transport and returns
+// the response, it is aborted if the context is canceled
+func exchangeDNS(ctx context.Context, server, transport string, query []byte, deadline time.Time) ([]byte, error) {
+	dialer := &net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, transport, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	stop := abortOnCancel(ctx, conn)
+	defer stop()
+
+	if transport == TCPTransport {
+		return exchangeDNSStream(conn, query)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore the datagrams answering another query
+		if n >= 2 && binary.BigEndian.Uint16(buf) == binary.BigEndian.Uint16(query) {
+			return buf[:n], nil
+		}
+	}
+}
+
+// abortOnCancel unblocks the reads and writes of the connection as soon as
+// the context is canceled, the returned function must be called once the
+// connection is not used anymore
+func abortOnCancel(ctx context.Context, conn net.Conn) func() bool {
+	return context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+}
+
+// exchangeDNSStream sends the query on a stream, prefixed by its length as
+// for TCP, and returns the response
+func exchangeDNSStream(conn io.ReadWriter, query []byte) ([]byte, error) {
+	msg := binary.BigEndian.AppendUint16(make([]byte, 0, len(query)+2), uint16(len(query)))
+	if _, err := conn.Write(append(msg, query...)); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
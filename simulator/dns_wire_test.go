@@ -0,0 +1,240 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// testDNSAnswer returns an A record answering the question of the query,
+// with a compression pointer to its name
+func testDNSAnswer(ip [4]byte) []byte {
+	answer := []byte{0xc0, dnsHeaderSize}
+	// Type A, class IN, TTL of 60s
+	answer = append(answer, 0, 1, 0, 1, 0, 0, 0, 60)
+	answer = binary.BigEndian.AppendUint16(answer, 4)
+	return append(answer, ip[:]...)
+}
+
+// testDNSResponse returns the response to the query with the response code
+// and the answers
+func testDNSResponse(query []byte, rcode int, answers ...[]byte) []byte {
+	msg := append([]byte{}, query...)
+	binary.BigEndian.PutUint16(msg[2:], 0x8180|uint16(rcode))
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(answers)))
+	for _, answer := range answers {
+		msg = append(msg, answer...)
+	}
+	return msg
+}
+
+func TestNewDNSQuery(t *testing.T) {
+	want := []byte{
+		0x12, 0x34, // id
+		0x01, 0x00, // recursion desired
+		0, 1, 0, 0, 0, 0, 0, 0, // one question
+		7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+		0, 28, // AAAA
+		0, 1, // IN
+	}
+	for _, name := range []string{"example.com", "example.com."} {
+		got, err := newDNSQuery(0x1234, name, dnsTypes["AAAA"])
+		if err != nil {
+			t.Fatalf("newDNSQuery(%q) error = %s", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("newDNSQuery(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestNewDNSQueryErrors(t *testing.T) {
+	label := strings.Repeat("a", 63)
+	for _, name := range []string{
+		"",
+		"a..b",
+		strings.Repeat("a", 64) + ".com",
+		strings.Repeat(label+".", 8) + "com",
+	} {
+		if _, err := newDNSQuery(1, name, dnsTypes["A"]); err == nil {
+			t.Errorf("newDNSQuery(%q) error = nil, want an error", name)
+		}
+	}
+}
+
+func TestParseDNSResponse(t *testing.T) {
+	query, err := newDNSQuery(42, "api.example.com", dnsTypes["A"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An answer with its full name rather than a pointer
+	uncompressed := append([]byte{3, 'a', 'p', 'i', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}, testDNSAnswer([4]byte{10, 0, 0, 3})[2:]...)
+
+	tests := []struct {
+		name    string
+		msg     []byte
+		rcode   string
+		answers int
+	}{
+		{"no answer", testDNSResponse(query, 0), "NOERROR", 0},
+		{"compressed answers", testDNSResponse(query, 0, testDNSAnswer([4]byte{10, 0, 0, 1}), testDNSAnswer([4]byte{10, 0, 0, 2})), "NOERROR", 2},
+		{"uncompressed answer", testDNSResponse(query, 0, uncompressed), "NOERROR", 1},
+		{"nxdomain", testDNSResponse(query, 3), "NXDOMAIN", 0},
+		{"servfail", testDNSResponse(query, 2), "SERVFAIL", 0},
+		{"unknown rcode", testDNSResponse(query, 9), "RCODE9", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := parseDNSResponse(tt.msg, 42)
+			if err != nil {
+				t.Fatalf("parseDNSResponse() error = %s", err)
+			}
+			if r.rcodeName() != tt.rcode || r.answers != tt.answers || r.size != len(tt.msg) || r.truncated {
+				t.Errorf("parseDNSResponse() = %+v (%s), want %s with %d answers", r, r.rcodeName(), tt.rcode, tt.answers)
+			}
+		})
+	}
+}
+
+func TestParseDNSResponseTruncated(t *testing.T) {
+	query, err := newDNSQuery(42, "example.com", dnsTypes["TXT"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The server announces answers it could not fit in the datagram
+	msg := testDNSResponse(query, 0, testDNSAnswer([4]byte{10, 0, 0, 1}))
+	msg = msg[:len(msg)-3]
+	binary.BigEndian.PutUint16(msg[2:], 0x8380)
+	r, err := parseDNSResponse(msg, 42)
+	if err != nil {
+		t.Fatalf("parseDNSResponse() error = %s", err)
+	}
+	if !r.truncated || r.answers != 1 {
+		t.Errorf("parseDNSResponse() = %+v, want a truncated response", r)
+	}
+}
+
+func TestParseDNSResponseErrors(t *testing.T) {
+	query, err := newDNSQuery(42, "example.com", dnsTypes["A"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := testDNSResponse(query, 0, testDNSAnswer([4]byte{10, 0, 0, 1}))
+	// withAnswer returns a response to the query with the given raw answer
+	withAnswer := func(answer ...byte) []byte {
+		return testDNSResponse(query, 0, answer)
+	}
+	// withQuestion returns a response with the given raw question
+	withQuestion := func(question ...byte) []byte {
+		return append(testDNSResponse(query, 0)[:dnsHeaderSize], question...)
+	}
+
+	tests := []struct {
+		name string
+		msg  []byte
+		want string
+	}{
+		{"empty", nil, "unexpected end"},
+		{"short header", response[:dnsHeaderSize-1], "unexpected end"},
+		{"unexpected id", testDNSResponse(append([]byte{0, 43}, query[2:]...), 0), "unexpected id"},
+		{"query", query, "not a response"},
+		{"truncated question", response[:dnsHeaderSize+5], "unexpected end"},
+		{"truncated question type", response[:len(query)-2], "unexpected end"},
+		{"truncated answer header", response[:len(query)+6], "unexpected end"},
+		{"truncated answer data", response[:len(response)-1], "unexpected end"},
+		{"label past the end", withQuestion(60, 'a', 'b'), "unexpected end"},
+		{"pointer loop", withQuestion(0xc0, dnsHeaderSize, 0, 1, 0, 1), "invalid compression pointer"},
+		{"forward pointer", withAnswer(0xc0, 0xff, 0, 1, 0, 1, 0, 0, 0, 60, 0, 0), "invalid compression pointer"},
+		{"pointer out of bounds", withAnswer(0xff, 0xff, 0, 1, 0, 1, 0, 0, 0, 60, 0, 0), "invalid compression pointer"},
+		{"pointer to the header", withAnswer(0xc0, 2, 0, 1, 0, 1, 0, 0, 0, 60, 0, 0), "invalid compression pointer"},
+		{"cut pointer", withAnswer(0xc0), "unexpected end"},
+		{"reserved label type", withAnswer(0x40, 0, 0, 1, 0, 1, 0, 0, 0, 60, 0, 0), "unknown label type"},
+		{"data past the end", withAnswer(0xc0, dnsHeaderSize, 0, 1, 0, 1, 0, 0, 0, 60, 0xff, 0xff, 10), "unexpected end"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := parseDNSResponse(tt.msg, 42)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseDNSResponse() = %+v, %v, want an error containing %q", r, err, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzParseDNSResponse(f *testing.F) {
+	query, err := newDNSQuery(42, "example.com", dnsTypes["A"])
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(testDNSResponse(query, 0, testDNSAnswer([4]byte{10, 0, 0, 1})))
+	f.Add(testDNSResponse(query, 3))
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		r, err := parseDNSResponse(msg, 42)
+		if err == nil && r.size != len(msg) {
+			t.Errorf("parseDNSResponse() size = %d, want %d", r.size, len(msg))
+		}
+	})
+}
+
+func TestExchangeDNSStream(t *testing.T) {
+	query, err := newDNSQuery(7, "example.com", dnsTypes["A"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := testDNSResponse(query, 0, testDNSAnswer([4]byte{10, 0, 0, 1}))
+
+	client, server := net.Pipe()
+	defer client.Close()
+	errs := make(chan error, 1)
+	go func() {
+		defer server.Close()
+		var length [2]byte
+		if _, err := io.ReadFull(server, length[:]); err != nil {
+			errs <- err
+			return
+		}
+		got := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(server, got); err != nil {
+			errs <- err
+			return
+		}
+		if !bytes.Equal(got, query) {
+			errs <- errors.New("the query differs from the one sent")
+			return
+		}
+		_, err := server.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(response))), response...))
+		errs <- err
+	}()
+
+	got, err := exchangeDNSStream(client, query)
+	if err != nil {
+		t.Fatalf("exchangeDNSStream() error = %s", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("server error = %s", err)
+	}
+	if !bytes.Equal(got, response) {
+		t.Errorf("exchangeDNSStream() = %v, want %v", got, response)
+	}
+}
+
+func TestExchangeDNSStreamShortResponse(t *testing.T) {
+	query, err := newDNSQuery(7, "example.com", dnsTypes["A"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The length announces more bytes than the stream holds
+	var stream struct {
+		io.Reader
+		io.Writer
+	}
+	stream.Reader = bytes.NewReader([]byte{0, 20, 0, 7, 0x81})
+	stream.Writer = io.Discard
+	if _, err := exchangeDNSStream(stream, query); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("exchangeDNSStream() error = %v, want %s", err, io.ErrUnexpectedEOF)
+	}
+}
@@ -0,0 +1,130 @@
+package simulator
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event represents a request written in the event log
+type Event struct {
+	Worker         int                      `json:"worker"`
+	Seq            int                      `json:"seq"`
+	Stage          string                   `json:"stage,omitempty"`
+	Type           string                   `json:"type"`
+	URL            string                   `json:"url"`
+	Method         string                   `json:"method,omitempty"`
+	Protocol       string                   `json:"protocol,omitempty"`
+	Criticity      string                   `json:"criticity"`
+	Status         string                   `json:"status,omitempty"`
+	StatusCode     int                      `json:"status_code,omitempty"`
+	Assertion      string                   `json:"assertion,omitempty"`
+	Error          string                   `json:"error,omitempty"`
+	ErrorMessage   string                   `json:"error_message,omitempty"`
+	ErrorClass     string                   `json:"error_class,omitempty"`
+	Size           int64                    `json:"size_bytes"`
+	ConnReused     *bool                    `json:"conn_reused,omitempty"`
+	RecordType     string                   `json:"record_type,omitempty"`
+	Answers        *int                     `json:"answers,omitempty"`
+	Truncated      *bool                    `json:"truncated,omitempty"`
+	TLSVersion     string                   `json:"tls_version,omitempty"`
+	TLSCipherSuite string                   `json:"tls_cipher_suite,omitempty"`
+	ALPN           string                   `json:"alpn,omitempty"`
+	Start          time.Time                `json:"start"`
+	End            time.Time                `json:"end"`
+	Duration       time.Duration            `json:"duration_ns"`
+	Timeline       map[string]time.Duration `json:"timeline_ns,omitempty"`
+}
+
+// NewEvent returns an event filled with the fields common to all requests, the
+// type is set when the request is recorded
+func NewEvent(url string, start time.Time, d time.Duration, criticity CriticityLevel, err error) *Event {
+	e := &Event{
+		URL:       url,
+		Criticity: criticityName[criticity],
+		Start:     start,
+		End:       start.Add(d),
+		Duration:  d,
+	}
+	if err != nil {
+		if criticity != Interrupted {
+			e.Criticity = criticityName[Critical]
+		}
+		e.ErrorMessage = err.Error()
+		e.ErrorClass = errorClass(err)
+	}
+	return e
+}
+
+// EventLog writes one JSON object per request to a file
+type EventLog struct {
+	sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+	enc  *json.Encoder
+}
+
+// NewEventLog creates the event log file
+func NewEventLog(path string) (*EventLog, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(file)
+	return &EventLog{
+		file: file,
+		w:    w,
+		enc:  json.NewEncoder(w),
+	}, nil
+}
+
+// Write writes an event to the log
+func (l *EventLog) Write(e *Event) error {
+	l.Lock()
+	defer l.Unlock()
+	return l.enc.Encode(e)
+}
+
+// Close flushes the events and closes the file
+func (l *EventLog) Close() error {
+	l.Lock()
+	defer l.Unlock()
+	if err := l.w.Flush(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// errorClass returns the class of an error, among a bounded set of classes:
+// canceled, timeout, dns, tls, connect or other
+func errorClass(err error) string {
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var alertErr tls.AlertError
+	var recordErr tls.RecordHeaderError
+	var opErr *net.OpError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &certErr), errors.As(err, &alertErr), errors.As(err, &recordErr),
+		strings.Contains(err.Error(), "tls: "):
+		return "tls"
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return "connect"
+	default:
+		return "other"
+	}
+}
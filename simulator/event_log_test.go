@@ -0,0 +1,33 @@
+package simulator
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+)
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&url.Error{Op: "Get", URL: "http://a.example/1", Err: context.Canceled}, "canceled"},
+		{&url.Error{Op: "Get", URL: "http://a.example/2", Err: &net.DNSError{Err: "no such host", Name: "a.example", IsNotFound: true}}, "dns"},
+		{&url.Error{Op: "Get", URL: "http://a.example/3", Err: context.DeadlineExceeded}, "timeout"},
+		{&net.OpError{Op: "read", Net: "udp", Err: os.ErrDeadlineExceeded}, "timeout"},
+		{&url.Error{Op: "Get", URL: "https://a.example/4", Err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}}, "tls"},
+		{&url.Error{Op: "Get", URL: "http://a.example/5", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}, "connect"},
+		{fmt.Errorf("malformed DNS message: too short"), "other"},
+	}
+	for _, tt := range tests {
+		if got := errorClass(tt.err); got != tt.want {
+			t.Errorf("errorClass(%q) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package simulator
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+const (
+	// histogramSubBits is the number of bits of precision kept in each
+	// power of two, 5 bits gives a relative error below 3%
+	histogramSubBits = 5
+	// histogramSubBuckets is the number of buckets in each power of two
+	histogramSubBuckets = 1 << histogramSubBits
+	// histogramSize is the number of buckets needed to hold any duration
+	histogramSize = (64 - histogramSubBits) * histogramSubBuckets
+	// histogramRows is the number of rows of the rendered histograms
+	histogramRows = 10
+	// histogramWidth is the width of the largest bar of the rendered histograms
+	histogramWidth = 40
+)
+
+// percentiles are the percentiles rendered in the stats
+var percentiles = []float64{50, 90, 99, 99.9}
+
+// Histogram represents a log-linear histogram of durations, with a bounded
+// memory and a relative error below 3%, two histograms can be merged
+type Histogram struct {
+	counts [histogramSize]int64
+	count  int64
+	min    time.Duration
+	max    time.Duration
+}
+
+// bucketIndex returns the index of the bucket holding the given duration
+func bucketIndex(d time.Duration) int {
+	if d < 0 {
+		d = 0
+	}
+	v := uint64(d)
+	if v < histogramSubBuckets {
+		return int(v)
+	}
+	exp := bits.Len64(v) - histogramSubBits - 1
+	return exp*histogramSubBuckets + int(v>>exp)
+}
+
+// bucketBounds returns the lower and upper bounds of the bucket at the given
+// index
+func bucketBounds(i int) (time.Duration, time.Duration) {
+	if i < histogramSubBuckets {
+		return time.Duration(i), time.Duration(i + 1)
+	}
+	exp := i/histogramSubBuckets - 1
+	sub := uint64(i%histogramSubBuckets + histogramSubBuckets)
+	return time.Duration(sub << exp), time.Duration((sub + 1) << exp)
+}
+
+// Record adds a duration to the histogram
+func (h *Histogram) Record(d time.Duration) {
+	h.counts[bucketIndex(d)]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+}
+
+// Merge adds all the durations of another histogram to the histogram
+func (h *Histogram) Merge(o *Histogram) {
+	if o.count == 0 {
+		return
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	if h.count == 0 || o.min < h.min {
+		h.min = o.min
+	}
+	if o.max > h.max {
+		h.max = o.max
+	}
+	h.count += o.count
+}
+
+// Count returns the number of durations in the histogram
+func (h *Histogram) Count() int64 {
+	return h.count
+}
+
+// Percentile returns the duration under which the given percentage of the
+// durations are
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(h.count)))
+	if rank < 1 {
+		rank = 1
+	}
+	var total int64
+	for i, c := range h.counts {
+		total += c
+		if total < rank {
+			continue
+		}
+		// Use the middle of the bucket, within the known bounds
+		lower, upper := bucketBounds(i)
+		d := lower + (upper-lower)/2
+		if d < h.min {
+			d = h.min
+		}
+		if d > h.max {
+			d = h.max
+		}
+		return d
+	}
+	return h.max
+}
+
+// percentileHeaders returns the headers of the percentiles columns
+func percentileHeaders() []string {
+	headers := make([]string, 0, len(percentiles))
+	for _, p := range percentiles {
+		headers = append(headers, "p"+strconv.FormatFloat(p, 'f', -1, 64))
+	}
+	return headers
+}
+
+// percentileRow returns the rendered percentiles of the histogram
+func (h *Histogram) percentileRow() []string {
+	row := make([]string, 0, len(percentiles))
+	for _, p := range percentiles {
+		if h.count == 0 {
+			row = append(row, "NaN")
+			continue
+		}
+		row = append(row, h.Percentile(p).String())
+	}
+	return row
+}
+
+// rowBounds returns the lower bounds of the rows of the rendered histogram,
+// spread logarithmically between the min and the max durations and rounded
+// as rendered, the rows with the same rounded bound are merged
+func (h *Histogram) rowBounds() []time.Duration {
+	precision := time.Microsecond
+	if h.max < 10*time.Microsecond {
+		precision = time.Nanosecond
+	}
+	bounds := make([]time.Duration, 0, histogramRows)
+	ratio := float64(h.max+1) / float64(h.min+1)
+	for r := 0; r < histogramRows; r++ {
+		lower := time.Duration(float64(h.min+1)*math.Pow(ratio, float64(r)/histogramRows)) - 1
+		lower = lower.Round(precision)
+		if len(bounds) > 0 && lower <= bounds[len(bounds)-1] {
+			continue
+		}
+		bounds = append(bounds, lower)
+	}
+	return bounds
+}
+
+// Render renders the histogram as an ASCII chart, the rows are spread
+// logarithmically between the min and the max durations
+func (h *Histogram) Render(out io.Writer, name string) {
+	if h.count == 0 {
+		return
+	}
+
+	// Put each bucket in its row
+	lowers := h.rowBounds()
+	rows := make([]int64, len(lowers))
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		lower, upper := bucketBounds(i)
+		d := lower + (upper-lower)/2
+		r := len(rows) - 1
+		for r > 0 && d < lowers[r] {
+			r--
+		}
+		rows[r] += c
+	}
+
+	var maxCount int64
+	for _, c := range rows {
+		if c > maxCount {
+			maxCount = c
+		}
+	}
+
+	table := tablewriter.NewWriter(out)
+	table.SetHeader([]string{"Duration", "Count", ""})
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_LEFT})
+	for r, c := range rows {
+		bar := strings.Repeat("■", int(c*histogramWidth/maxCount))
+		table.Append([]string{
+			"≥ " + lowers[r].String(),
+			strconv.FormatInt(c, 10),
+			bar,
+		})
+	}
+
+	fmt.Fprintf(out, "\n%s histogram :\n", name)
+	table.Render()
+}
@@ -0,0 +1,125 @@
+package simulator
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestBucketBounds(t *testing.T) {
+	values := []time.Duration{0, 1, 31, 32, 33, 63, 64, 1000, time.Microsecond, 1234567, time.Second, time.Hour, 1<<62 + 12345}
+	for _, d := range values {
+		i := bucketIndex(d)
+		lower, upper := bucketBounds(i)
+		if d < lower || d >= upper {
+			t.Errorf("bucketBounds(bucketIndex(%d)) = [%d, %d), want it to hold %d", d, lower, upper, d)
+		}
+		if got := bucketIndex(lower); got != i {
+			t.Errorf("bucketIndex(%d) = %d, want %d", lower, got, i)
+		}
+		if got := bucketIndex(upper - 1); got != i {
+			t.Errorf("bucketIndex(%d) = %d, want %d", upper-1, got, i)
+		}
+	}
+}
+
+func TestBucketIndexIsContiguous(t *testing.T) {
+	for i := 0; i < histogramSize-1; i++ {
+		_, upper := bucketBounds(i)
+		lower, _ := bucketBounds(i + 1)
+		if upper != lower {
+			t.Fatalf("bucket %d ends at %d but bucket %d starts at %d", i, upper, i+1, lower)
+		}
+	}
+}
+
+func TestBucketIndexNegative(t *testing.T) {
+	if got := bucketIndex(-time.Second); got != 0 {
+		t.Errorf("bucketIndex(-1s) = %d, want 0", got)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var h Histogram
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{50, 500 * time.Millisecond},
+		{90, 900 * time.Millisecond},
+		{99, 990 * time.Millisecond},
+		{99.9, 999 * time.Millisecond},
+		{100, time.Second},
+	}
+	for _, tt := range tests {
+		got := h.Percentile(tt.p)
+		if diff := float64(got-tt.want) / float64(tt.want); diff > 0.03 || diff < -0.03 {
+			t.Errorf("Percentile(%v) = %s, want %s within 3%%", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestPercentileWithinMinMax(t *testing.T) {
+	var h Histogram
+	h.Record(1001 * time.Microsecond)
+	for _, p := range percentiles {
+		if got := h.Percentile(p); got != 1001*time.Microsecond {
+			t.Errorf("Percentile(%v) = %s, want the only duration", p, got)
+		}
+	}
+
+	var empty Histogram
+	if got := empty.Percentile(50); got != 0 {
+		t.Errorf("Percentile(50) of an empty histogram = %s, want 0", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	var a, b, all Histogram
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		d := time.Duration(rng.Int63n(int64(time.Second)))
+		if i%2 == 0 {
+			a.Record(d)
+		} else {
+			b.Record(d)
+		}
+		all.Record(d)
+	}
+	a.Merge(&b)
+	if a != all {
+		t.Errorf("merged histogram differs from the histogram of all the durations")
+	}
+}
+
+func TestRowBounds(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max time.Duration
+	}{
+		{"zero min", 0, 80 * time.Millisecond},
+		{"same durations", 5 * time.Millisecond, 5 * time.Millisecond},
+		{"nanoseconds", 0, 3},
+		{"wide range", time.Microsecond, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h Histogram
+			h.Record(tt.min)
+			h.Record(tt.max)
+			bounds := h.rowBounds()
+			if len(bounds) == 0 || len(bounds) > histogramRows {
+				t.Fatalf("got %d rows, want between 1 and %d", len(bounds), histogramRows)
+			}
+			for i := 1; i < len(bounds); i++ {
+				if bounds[i] <= bounds[i-1] {
+					t.Errorf("row %d starts at %s after a row starting at %s", i, bounds[i], bounds[i-1])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package simulator
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Connection modes
+const (
+	// SharedConnections shares a pool of connections between all the workers
+	SharedConnections = "shared"
+	// WorkerConnections gives a pool of connections to each worker
+	WorkerConnections = "worker"
+	// FreshConnections opens a new connection for each request
+	FreshConnections = "fresh"
+)
+
+// HTTP2Traffic is the traffic type making the HTTP requests over HTTP/2 only,
+// with h2c for the http URLs
+const HTTP2Traffic = "http2"
+
+// trackedConn is a connection with an id, to count its requests
+type trackedConn struct {
+	net.Conn
+	id uint64
+}
+
+// CheckConnectionMode returns an error if the connection mode is unknown
+func CheckConnectionMode(mode string) error {
+	switch mode {
+	case SharedConnections, WorkerConnections, FreshConnections:
+		return nil
+	default:
+		return fmt.Errorf("unknown connection mode %q, expected shared, worker or fresh", mode)
+	}
+}
+
+// newHTTPClient returns a new HTTP client with its own pool of connections,
+// the connections are not kept alive if reuse is false
+func (trafficGen *TrafficGenerator) newHTTPClient(reuse bool) *http.Client {
+	opts := &trafficGen.opts
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	tr := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &trackedConn{Conn: conn, id: trafficGen.lastConnID.Add(1)}, nil
+		},
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		DisableKeepAlives:     !reuse,
+		// Each transport gets its own copy, as the transport sets up the
+		// protocols of its configuration for HTTP/2
+		TLSClientConfig: trafficGen.tlsConfig.Clone(),
+		// The TLS configuration would disable HTTP/2 otherwise
+		ForceAttemptHTTP2: true,
+	}
+	if opts.Type == HTTP2Traffic {
+		tr.Protocols = new(http.Protocols)
+		tr.Protocols.SetHTTP2(true)
+		tr.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return &http.Client{
+		Transport: tr,
+		Timeout:   opts.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// Check if we need to follow redirect or no
+			if opts.FollowRedirect {
+				return nil
+			}
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// HTTPClient returns the HTTP client to use for the next request of the
+// worker, and a function to call once the request is done
+func (w *Worker) HTTPClient() (*http.Client, func()) {
+	trafficGen := w.trafficGen
+	switch trafficGen.opts.Connections {
+	case SharedConnections:
+		trafficGen.sharedClientOnce.Do(func() { trafficGen.sharedClient = trafficGen.newHTTPClient(true) })
+		return trafficGen.sharedClient, func() {}
+	case WorkerConnections:
+		w.clientOnce.Do(func() { w.client = trafficGen.newHTTPClient(true) })
+		return w.client, func() {}
+	default:
+		client := trafficGen.newHTTPClient(false)
+		return client, client.CloseIdleConnections
+	}
+}
+
+// connID returns the id of the connection, or 0 if it is unknown
+func connID(conn net.Conn) uint64 {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if c, ok := conn.(*trackedConn); ok {
+		return c.id
+	}
+	return 0
+}
+
+// openStream counts a new request in flight on the connection, and returns
+// the number of requests in flight on it
+func (trafficGen *TrafficGenerator) openStream(id uint64) int {
+	trafficGen.activeStreamsMu.Lock()
+	defer trafficGen.activeStreamsMu.Unlock()
+	trafficGen.activeStreams[id]++
+	return trafficGen.activeStreams[id]
+}
+
+// closeStream counts the end of a request on the connection
+func (trafficGen *TrafficGenerator) closeStream(id uint64) {
+	trafficGen.activeStreamsMu.Lock()
+	defer trafficGen.activeStreamsMu.Unlock()
+	trafficGen.activeStreams[id]--
+	if trafficGen.activeStreams[id] <= 0 {
+		delete(trafficGen.activeStreams, id)
+	}
+}
+
+// closeIdleConnections closes the connections kept by the client of the
+// worker, once it is done
+func (w *Worker) closeIdleConnections() {
+	if w.client != nil {
+		w.client.CloseIdleConnections()
+	}
+}
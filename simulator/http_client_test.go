@@ -0,0 +1,176 @@
+package simulator
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConnectionModes(t *testing.T) {
+	tests := []struct {
+		mode string
+		// opened is the number of connections opened by 2 clients making 3
+		// requests each, 0 if it depends on the scheduling
+		opened int64
+	}{
+		{FreshConnections, 6},
+		{WorkerConnections, 2},
+		{SharedConnections, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			var opened, open atomic.Int64
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+			ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+				switch state {
+				case http.StateNew:
+					opened.Add(1)
+					open.Add(1)
+				case http.StateClosed, http.StateHijacked:
+					open.Add(-1)
+				}
+			}
+			ts.Start()
+			defer ts.Close()
+
+			opts := DefaultOptions()
+			opts.Clients = 2
+			opts.Requests = 3
+			opts.Wait = 0
+			opts.Connections = tt.mode
+			opts.URLs = []URLEntry{{URL: ts.URL, Weight: 1}}
+			opts.Output = io.Discard
+			trafficGen, err := NewTrafficGenerator(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			trafficGen.Generate(context.Background())
+
+			if s := trafficGen.Summary(); s.Requests != 6 {
+				t.Fatalf("Summary() = %d requests, want 6", s.Requests)
+			}
+			if tt.opened != 0 && opened.Load() != tt.opened {
+				t.Errorf("%d connections opened, want %d", opened.Load(), tt.opened)
+			}
+			// The connections are closed once the run is over
+			deadline := time.Now().Add(time.Second)
+			for open.Load() != 0 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if open.Load() != 0 {
+				t.Errorf("%d connections still open after the run", open.Load())
+			}
+		})
+	}
+}
+
+func TestStreamsArePerGenerator(t *testing.T) {
+	var gens [2]*TrafficGenerator
+	for i := range gens {
+		gen, err := NewTrafficGenerator(Options{Requests: 1, Clients: 1, URLs: []URLEntry{{URL: "http://127.0.0.1", Weight: 1}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		gens[i] = gen
+	}
+
+	a, b := gens[0], gens[1]
+	if got := a.lastConnID.Add(1); got != 1 {
+		t.Errorf("first connection id of a generator = %d, want 1", got)
+	}
+	if got := b.lastConnID.Add(1); got != 1 {
+		t.Errorf("first connection id of another generator = %d, want 1", got)
+	}
+
+	a.openStream(1)
+	if got := a.openStream(1); got != 2 {
+		t.Errorf("openStream() = %d, want 2", got)
+	}
+	if got := b.openStream(1); got != 1 {
+		t.Errorf("openStream() on another generator = %d, want 1", got)
+	}
+	a.closeStream(1)
+	a.closeStream(1)
+	if len(a.activeStreams) != 0 {
+		t.Errorf("activeStreams = %v, want the closed connection removed", a.activeStreams)
+	}
+}
+
+func TestStreamsOfRedirectedRequests(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/" {
+			http.Redirect(w, req, "/moved", http.StatusFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	for _, mode := range []string{FreshConnections, WorkerConnections, SharedConnections} {
+		t.Run(mode, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Clients = 2
+			opts.Requests = 3
+			opts.Wait = 0
+			opts.Connections = mode
+			opts.URLs = []URLEntry{{URL: ts.URL, Weight: 1}}
+			opts.Output = io.Discard
+			trafficGen, err := NewTrafficGenerator(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			trafficGen.Generate(context.Background())
+
+			if s := trafficGen.Summary(); s.Criticities["success"] != 6 {
+				t.Fatalf("criticities = %v, want 6 successes", s.Criticities)
+			}
+			// Each hop of the redirects gets a connection, the streams are
+			// all closed once the requests are done
+			if len(trafficGen.activeStreams) != 0 {
+				t.Errorf("activeStreams = %v, want no stream left open", trafficGen.activeStreams)
+			}
+		})
+	}
+}
+
+func TestH2C(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.ProtoMajor != 2 {
+			t.Errorf("request over %s, want HTTP/2", req.Proto)
+		}
+		// The requests last long enough to be in flight together
+		time.Sleep(50 * time.Millisecond)
+	}))
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	defer ts.Close()
+
+	opts := DefaultOptions()
+	opts.Type = HTTP2Traffic
+	opts.Clients = 4
+	opts.Requests = 3
+	opts.Wait = 0
+	opts.Connections = SharedConnections
+	opts.URLs = []URLEntry{{URL: ts.URL, Weight: 1}}
+	opts.Output = io.Discard
+	trafficGen, err := NewTrafficGenerator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trafficGen.Generate(context.Background())
+
+	s := trafficGen.Summary()
+	if s.Criticities["success"] != 12 || s.Protocols["HTTP/2.0"].Requests != 12 {
+		t.Fatalf("criticities = %v and protocols = %v, want 12 HTTP/2.0 successes", s.Criticities, s.Protocols)
+	}
+	// The clients share a connection, their requests are multiplexed on it
+	if c := s.Connections; c.MaxConcurrentStreams < 2 || c.MaxStreams < 2 {
+		t.Errorf("connections = %+v, want multiplexed streams", *c)
+	}
+}
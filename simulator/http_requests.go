@@ -0,0 +1,446 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// HTTPRequest represents a request response, with the return code and the duration
+type HTTPRequest struct {
+	status           string
+	statusShort      string
+	url              string
+	statusCode       int
+	method           string
+	criticity        CriticityLevel
+	start            time.Time
+	duration         time.Duration
+	err              error
+	size             int64
+	responseTimeline *ResponseTimeline
+	reused           bool
+	tls              *TLSInfo
+	// proto is the protocol of the response, like "HTTP/2.0"
+	proto string
+	// connID is the id of the connection of the request, and streams the
+	// number of requests in flight on it when the request started
+	connID  uint64
+	streams int
+	// failure is the reason why the response failed the assertions of its
+	// URL
+	failure string
+}
+
+// TLSInfo represents the parameters negotiated with TLS
+type TLSInfo struct {
+	Version     string
+	CipherSuite string
+	ALPN        string
+}
+
+type ResponseTimeline struct {
+	DNSLookup              time.Duration
+	TCPConnection          time.Duration
+	TLSHandshake           time.Duration
+	EstablishingConnection time.Duration
+	ServerProcessing       time.Duration
+	ContentTransfer        time.Duration
+}
+
+// timelinePhase represents a named step of the response timeline
+type timelinePhase struct {
+	name     string
+	duration time.Duration
+}
+
+// phases returns the steps of the response timeline, in order
+func (t *ResponseTimeline) phases() []timelinePhase {
+	return []timelinePhase{
+		{"DNSLookup", t.DNSLookup},
+		{"TCPConnection", t.TCPConnection},
+		{"TLSHandshake", t.TLSHandshake},
+		{"EstablishingConnection", t.EstablishingConnection},
+		{"ServerProcessing", t.ServerProcessing},
+		{"ContentTransfer", t.ContentTransfer},
+	}
+}
+
+// String will return the string representing the request
+func (r HTTPRequest) String() string {
+	if r.IsError() {
+		return fmt.Sprintf("| %s | %13s | %s %s : %s ( %s )", errorLabel(r.criticity), r.duration, methodName(r.method), r.url, r.Error(), humanize.Bytes(uint64(r.size)))
+	}
+	if r.failure != "" {
+		return fmt.Sprintf("| %s | %13s | %s %s : %s ( %s )", criticityColor[r.criticity](r.statusShort), r.duration, methodName(r.method), r.url, r.failure, humanize.Bytes(uint64(r.size)))
+	}
+	return fmt.Sprintf("| %s | %13s | %s %s ( %s )", criticityColor[r.criticity](r.statusShort), r.duration, methodName(r.method), r.url, humanize.Bytes(uint64(r.size)))
+}
+
+// methodName returns the HTTP method as written in the logs, like "Get"
+func methodName(method string) string {
+	if method == "" {
+		return "Get"
+	}
+	return method[:1] + strings.ToLower(method[1:])
+}
+
+// Duration returns the duration of the request
+func (r HTTPRequest) Duration() time.Duration {
+	return r.duration
+}
+
+// Criticity returns the criticity level of the request
+func (r HTTPRequest) Criticity() CriticityLevel {
+	return r.criticity
+}
+
+// AddDelay adds the time spent waiting to be dispatched to the duration
+func (r *HTTPRequest) AddDelay(d time.Duration) {
+	r.start = r.start.Add(-d)
+	r.duration += d
+}
+
+// Event returns the event representing the request
+func (r *HTTPRequest) Event() *Event {
+	e := NewEvent(r.url, r.start, r.duration, r.criticity, r.err)
+	e.Method = r.method
+	e.Status = r.status
+	e.StatusCode = r.statusCode
+	e.Size = r.size
+	e.Protocol = r.proto
+	e.Assertion = r.failure
+	if r.err != nil {
+		e.Error = r.Error()
+	}
+	if r.tls != nil {
+		e.TLSVersion = r.tls.Version
+		e.TLSCipherSuite = r.tls.CipherSuite
+		e.ALPN = r.tls.ALPN
+	}
+	if r.responseTimeline != nil {
+		e.ConnReused = &r.reused
+		e.Timeline = map[string]time.Duration{}
+		for _, phase := range r.responseTimeline.phases() {
+			e.Timeline[phase.name] = phase.duration
+		}
+	}
+	return e
+}
+
+// Error returns the error of the request
+func (r HTTPRequest) Error() string {
+	var errName string
+
+	switch e := r.err.(type) {
+	case *net.DNSError:
+		errName = "DNS lookup error"
+	case *net.DNSConfigError:
+		errName = "DNS config error"
+	case *net.AddrError:
+		errName = "Addr Error"
+	case *net.OpError:
+		errName = "Op Error"
+	case *url.Error:
+		if e.Timeout() {
+			errName = "URL Timeout"
+		} else {
+			errName = fmt.Sprintf("URL Error: %s", e.Error())
+		}
+	case net.Error:
+		errName = "Net Error"
+	default:
+		errName = e.Error()
+	}
+	return errName
+}
+
+// Size returns the size of the request
+func (r HTTPRequest) Size() int64 {
+	return r.size
+}
+
+// Status returns the status of the request, or the reason why it failed the
+// assertions
+func (r HTTPRequest) Status() string {
+	if r.failure != "" {
+		return "Assertion failed: " + r.failure
+	}
+	return r.status
+}
+
+// IsError returns true if the request is an error
+func (r HTTPRequest) IsError() bool {
+	return r.err != nil
+}
+
+// getURL will get a given URL with the connections of the worker and return
+// a Request, the templates of the URL, headers and body are evaluated with the
+// variables of the request, it is aborted if the context is canceled
+func getURL(ctx context.Context, entry *URLEntry, w *Worker, vars *RequestVars) Request {
+	var dnsStart, dnsDone, connectStart, connectDone, tlsStart, tlsDone, gotConn, gotByte time.Time
+	var reused bool
+	var conn uint64
+	var streams int
+	opts := w.Options()
+	url := NormalizeURL(vars.expand(entry.URL))
+	method := entry.Method
+	if method == "" {
+		method = opts.Method
+	}
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var dur time.Duration
+	// Initiate the time before the request
+
+	t := time.Now()
+
+	// Do the request
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(_ httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:  func(_ httptrace.DNSDoneInfo) { dnsDone = time.Now() },
+		ConnectStart: func(_, _ string) {
+			if dnsDone.IsZero() {
+				// connecting to IP
+				dnsDone = time.Now()
+			}
+			connectStart = time.Now()
+		},
+		ConnectDone: func(net, addr string, err error) {
+			if err != nil {
+				w.trafficGen.logger.Printf("unable to connect to host %v: %v", addr, err)
+			}
+			connectDone = time.Now()
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err != nil {
+				w.trafficGen.logger.Printf("unable to establish TLS: %v", err)
+			}
+			tlsDone = time.Now()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			reused = info.Reused
+			gotConn = time.Now()
+			// A retried or redirected request gets another connection, it
+			// only holds a stream on the last one
+			if conn != 0 {
+				w.trafficGen.closeStream(conn)
+			}
+			if conn = connID(info.Conn); conn != 0 {
+				streams = w.trafficGen.openStream(conn)
+			}
+		},
+		GotFirstResponseByte: func() { gotByte = time.Now() },
+	}
+
+	reqBody, reqContentType := entry.Body, entry.ContentType
+	if reqBody == "" {
+		reqBody = opts.Body
+	}
+	if reqContentType == "" {
+		reqContentType = opts.ContentType
+	}
+
+	reqBody = vars.expand(reqBody)
+	b := strings.NewReader(reqBody)
+	req, err := http.NewRequest(method, url, b)
+	if err != nil {
+		dur = time.Since(t)
+		return &HTTPRequest{
+			url:       url,
+			method:    method,
+			start:     t,
+			duration:  dur,
+			err:       err,
+			criticity: Critical,
+		}
+	}
+
+	if reqContentType == "" && reqBody != "" {
+		reqContentType = guessContentType(reqBody)
+	}
+	if reqContentType != "" {
+		req.Header.Set("Content-Type", reqContentType)
+	}
+	// The headers are evaluated in order for the templates to be reproducible
+	for _, key := range sortedKeys(opts.Headers) {
+		req.Header.Set(key, vars.expand(opts.Headers[key]))
+	}
+	for _, key := range sortedKeys(entry.Headers) {
+		req.Header.Set(key, vars.expand(entry.Headers[key]))
+	}
+	// The Host header is not sent from the headers of the request
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+		req.Header.Del("Host")
+	}
+
+	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+
+	client, done := w.HTTPClient()
+	defer done()
+	defer func() {
+		if conn != 0 {
+			w.trafficGen.closeStream(conn)
+		}
+	}()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		dur = time.Since(t)
+		return &HTTPRequest{
+			url:       url,
+			method:    method,
+			start:     t,
+			duration:  dur,
+			err:       err,
+			criticity: errorCriticity(ctx),
+		}
+	}
+
+	defer resp.Body.Close()
+
+	// Read the full body, it is only kept to be checked
+	var respBody bytes.Buffer
+	var dst io.Writer = io.Discard
+	if entry.Assertions.needsBody() {
+		dst = &respBody
+	}
+	length, err := io.Copy(dst, resp.Body)
+	if err != nil {
+		dur = time.Since(t)
+		return &HTTPRequest{
+			url:       url,
+			method:    method,
+			start:     t,
+			duration:  dur,
+			err:       err,
+			criticity: errorCriticity(ctx),
+			size:      length,
+		}
+	}
+	// Record the duration of the request
+	allDone := time.Now()
+	dur = time.Since(t)
+
+	// If some http statuses has no StatusText, return a simple string with the
+	// http status
+	statusText := http.StatusText(resp.StatusCode)
+	if statusText == "" {
+		statusText = fmt.Sprintf("%d", resp.StatusCode)
+	}
+
+	// An unexpected status is a failed assertion if the statuses of the URL
+	// are given
+	var reqCriticity CriticityLevel
+	var failure string
+	switch {
+	case isExpectedStatus(entry, resp.StatusCode):
+		if failure = entry.Assertions.check(resp, respBody.Bytes(), length); failure != "" {
+			reqCriticity = Failed
+		}
+	case len(entry.ExpectedStatus) > 0:
+		reqCriticity = Failed
+		failure = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	default:
+		reqCriticity = Warning
+	}
+
+	// A reused connection has no DNS lookup nor connection steps, the
+	// connection is established once the TLS handshake is done if any
+	established := connectDone
+	if !tlsDone.IsZero() {
+		established = tlsDone
+	}
+	responseTimeline := ResponseTimeline{
+		DNSLookup:              between(dnsStart, dnsDone),
+		TCPConnection:          between(connectStart, connectDone),
+		TLSHandshake:           between(tlsStart, tlsDone),
+		EstablishingConnection: between(established, gotConn),
+		ServerProcessing:       between(gotConn, gotByte),
+		ContentTransfer:        between(gotByte, allDone),
+	}
+
+	return &HTTPRequest{
+		url:              url,
+		method:           method,
+		start:            t,
+		statusCode:       resp.StatusCode,
+		duration:         dur,
+		status:           statusText,
+		statusShort:      strconv.Itoa(resp.StatusCode),
+		criticity:        reqCriticity,
+		size:             length,
+		reused:           reused,
+		responseTimeline: &responseTimeline,
+		tls:              newTLSInfo(resp.TLS),
+		proto:            resp.Proto,
+		connID:           conn,
+		streams:          streams,
+		failure:          failure,
+	}
+}
+
+// newTLSInfo returns the parameters of a TLS connection, or nil if the
+// connection is not encrypted
+func newTLSInfo(state *tls.ConnectionState) *TLSInfo {
+	if state == nil {
+		return nil
+	}
+	alpn := state.NegotiatedProtocol
+	if alpn == "" {
+		alpn = "none"
+	}
+	return &TLSInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        alpn,
+	}
+}
+
+// guessContentType returns the content type of a body, JSON or as sniffed by
+// the net/http package
+func guessContentType(b string) string {
+	if json.Valid([]byte(b)) {
+		return "application/json"
+	}
+	return http.DetectContentType([]byte(b))
+}
+
+// isExpectedStatus returns true if the status code is expected for the URL,
+// only 200 is expected by default
+func isExpectedStatus(entry *URLEntry, code int) bool {
+	if len(entry.ExpectedStatus) == 0 {
+		return code == http.StatusOK
+	}
+	for _, expected := range entry.ExpectedStatus {
+		if code == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// between returns the duration between two times of the trace, or 0 if one of
+// them did not happen
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
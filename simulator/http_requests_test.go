@@ -0,0 +1,101 @@
+package simulator
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestOverrides(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		entry URLEntry
+		// want are the method, the Host, the X-A header, the content type
+		// and the body received by the server
+		want [5]string
+	}{
+		{
+			"defaults",
+			Options{},
+			URLEntry{},
+			[5]string{"GET", "", "", "", ""},
+		},
+		{
+			"global",
+			Options{Method: "POST", Headers: map[string]string{"X-A": "global", "Host": "global.test"}, Body: "a=1", ContentType: "text/plain"},
+			URLEntry{},
+			[5]string{"POST", "global.test", "global", "text/plain", "a=1"},
+		},
+		{
+			"URL over global",
+			Options{Method: "POST", Headers: map[string]string{"X-A": "global", "Host": "global.test"}, Body: "a=1", ContentType: "text/plain"},
+			URLEntry{Method: "PUT", Headers: map[string]string{"x-a": "url", "host": "url.test"}, Body: "b=2", ContentType: "application/x-www-form-urlencoded"},
+			[5]string{"PUT", "url.test", "url", "application/x-www-form-urlencoded", "b=2"},
+		},
+		{
+			"URL completing global",
+			Options{Method: "POST", Headers: map[string]string{"X-A": "global"}, Body: "a=1"},
+			URLEntry{Headers: map[string]string{"Host": "url.test"}},
+			[5]string{"POST", "url.test", "global", "text/plain; charset=utf-8", "a=1"},
+		},
+		{
+			"guessed content type",
+			Options{Method: "POST"},
+			URLEntry{Body: `{"cart": 42}`},
+			[5]string{"POST", "", "", "application/json", `{"cart": 42}`},
+		},
+		{
+			"header over guessed content type",
+			Options{Method: "POST", Headers: map[string]string{"Content-Type": "application/vnd.api+json"}},
+			URLEntry{Body: `{"cart": 42}`},
+			[5]string{"POST", "", "", "application/vnd.api+json", `{"cart": 42}`},
+		},
+		{
+			"templates",
+			Options{Headers: map[string]string{"X-A": "{{seq}}", "Host": "{{workerID}}.test"}},
+			URLEntry{},
+			[5]string{"GET", "3.test", "7", "", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [5]string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				body, _ := io.ReadAll(req.Body)
+				got = [5]string{req.Method, req.Host, req.Header.Get("X-A"), req.Header.Get("Content-Type"), string(body)}
+				if req.Header.Get("Host") != "" {
+					t.Errorf("the Host header was sent with the headers")
+				}
+			}))
+			defer ts.Close()
+
+			opts := DefaultOptions()
+			opts.Method, opts.Headers, opts.Body, opts.ContentType = tt.opts.Method, tt.opts.Headers, tt.opts.Body, tt.opts.ContentType
+			opts.Clients = 1
+			opts.Requests = 1
+			trafficGen, err := NewTrafficGenerator(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entry := tt.entry
+			entry.URL, entry.Weight = ts.URL, 1
+			w := trafficGen.NewWorker(3)
+			vars := &RequestVars{templates: trafficGen.templates, worker: 3, seq: 7}
+			if r := getURL(context.Background(), &entry, w, vars); r.IsError() {
+				t.Fatalf("getURL() error = %s", r.Error())
+			}
+
+			// The server sees the address of the test server without a Host
+			want := tt.want
+			if want[1] == "" {
+				want[1] = ts.Listener.Addr().String()
+			}
+			if got != want {
+				t.Errorf("request = %q, want %q", got, want)
+			}
+		})
+	}
+}
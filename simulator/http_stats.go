@@ -0,0 +1,391 @@
+package simulator
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+)
+
+// HTTPStats represents the stats of the requests
+type HTTPStats struct {
+	DurationStats
+	ScheduleStats
+	sync.Mutex
+	opts            *Options
+	nbOfRequests    int
+	successRequests int
+	statusStats     map[string]int
+	statusCodes     map[string]int
+	criticities     map[string]int
+	// serverErrors counts the warnings with a 5xx status, they are errors
+	serverErrors     int
+	totalSize        int64
+	responseTimeline *ResponseTimeline
+	newConns         int
+	reusedConns      int
+	// timelineHistograms holds the histogram of each step of the timeline
+	timelineHistograms map[string]*Histogram
+	// tlsVersions, tlsCipherSuites and alpn count the requests made with
+	// each negotiated TLS parameter
+	tlsVersions     map[string]int
+	tlsCipherSuites map[string]int
+	alpn            map[string]int
+	// protocols holds the stats of the responses of each protocol
+	protocols map[string]*protocolStat
+	// connStreams holds the streams of each connection
+	connStreams map[uint64]*connStat
+}
+
+// protocolStat represents the stats of the responses of a protocol
+type protocolStat struct {
+	requests      int
+	totalDuration time.Duration
+	histogram     Histogram
+}
+
+// connStat represents the streams of a connection, HTTP/2 multiplexes the
+// requests on a connection while HTTP/1.1 makes them one after the other
+type connStat struct {
+	streams       int
+	maxConcurrent int
+}
+
+// NewHTTPStats will return an empty Stats object
+func NewHTTPStats(opts *Options) Stats {
+	return &HTTPStats{
+		opts:               opts,
+		DurationStats:      DurationStats{},
+		statusStats:        map[string]int{},
+		statusCodes:        map[string]int{},
+		criticities:        map[string]int{},
+		responseTimeline:   &ResponseTimeline{},
+		timelineHistograms: map[string]*Histogram{},
+		tlsVersions:        map[string]int{},
+		tlsCipherSuites:    map[string]int{},
+		alpn:               map[string]int{},
+		protocols:          map[string]*protocolStat{},
+		connStreams:        map[uint64]*connStat{},
+	}
+}
+
+// AddRequest will add a request to the stats
+func (s *HTTPStats) AddRequest(req Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.nbOfRequests++
+	s.addDuration(req)
+	s.totalSize += req.Size()
+	s.criticities[criticityName[req.Criticity()]]++
+	if r, ok := req.(*HTTPRequest); ok && r.statusCode != 0 {
+		s.statusCodes[strconv.Itoa(r.statusCode)]++
+		if r.statusCode >= 500 && req.Criticity() == Warning {
+			s.serverErrors++
+		}
+	}
+
+	if req.IsError() {
+		s.statusStats[req.Error()]++
+		return
+	}
+	s.successRequests++
+	s.statusStats[req.Status()]++
+}
+
+// addDuration will add the duration of a requests to the stats
+func (s *HTTPStats) addDuration(req Request) {
+	s.record(req.Duration())
+	// The details are only known for the HTTP requests, a traffic type
+	// returning its own requests only gets their duration recorded
+	r, ok := req.(*HTTPRequest)
+	if !ok {
+		return
+	}
+	if r.tls != nil {
+		s.tlsVersions[r.tls.Version]++
+		s.tlsCipherSuites[r.tls.CipherSuite]++
+		s.alpn[r.tls.ALPN]++
+	}
+	if r.responseTimeline == nil {
+		return
+	}
+	s.addProtocol(r)
+	if r.reused {
+		s.reusedConns++
+	} else {
+		s.newConns++
+	}
+	s.responseTimeline.DNSLookup += r.responseTimeline.DNSLookup
+	s.responseTimeline.TCPConnection += r.responseTimeline.TCPConnection
+	s.responseTimeline.TLSHandshake += r.responseTimeline.TLSHandshake
+	s.responseTimeline.EstablishingConnection += r.responseTimeline.EstablishingConnection
+	s.responseTimeline.ServerProcessing += r.responseTimeline.ServerProcessing
+	s.responseTimeline.ContentTransfer += r.responseTimeline.ContentTransfer
+
+	for _, phase := range r.responseTimeline.phases() {
+		h, ok := s.timelineHistograms[phase.name]
+		if !ok {
+			h = &Histogram{}
+			s.timelineHistograms[phase.name] = h
+		}
+		h.Record(phase.duration)
+	}
+}
+
+// addProtocol will add a response to the stats of its protocol and of its
+// connection
+func (s *HTTPStats) addProtocol(r *HTTPRequest) {
+	p, ok := s.protocols[r.proto]
+	if !ok {
+		p = &protocolStat{}
+		s.protocols[r.proto] = p
+	}
+	p.requests++
+	p.totalDuration += r.duration
+	p.histogram.Record(r.duration)
+
+	if r.connID == 0 {
+		return
+	}
+	c, ok := s.connStreams[r.connID]
+	if !ok {
+		c = &connStat{}
+		s.connStreams[r.connID] = c
+	}
+	c.streams++
+	if r.streams > c.maxConcurrent {
+		c.maxConcurrent = r.streams
+	}
+}
+
+// Render renders the results
+func (s *HTTPStats) Render() {
+	out := s.opts.output()
+	table := tablewriter.NewWriter(out)
+	table.SetAlignment(tablewriter.ALIGN_CENTER)
+	table.SetHeader([]string{
+		"Number of requests ",
+		"Min duration",
+		"Max duration",
+		"Average duration",
+		"Exec duration",
+		"Avg speed",
+		"Total size",
+	})
+	table.Append([]string{
+		strconv.Itoa(s.nbOfRequests),
+		s.minDuration.String(),
+		s.maxDuration.String(),
+		getAvgDuration(s.totalDuration, s.nbOfRequests),
+		s.execDuration.String(),
+		fmt.Sprintf("%s/s", humanize.Bytes(uint64(s.avgSpeed()))),
+		humanize.Bytes(uint64(s.totalSize)),
+	})
+
+	fmt.Fprintf(out, "\nStats :\n")
+	table.Render()
+
+	s.renderPercentiles(out)
+
+	statusTable := tablewriter.NewWriter(out)
+	statusTable.SetAlignment(tablewriter.ALIGN_CENTER)
+	statusTable.SetHeader([]string{"Result", "Count"})
+	for key, value := range s.statusStats {
+		statusTable.Append([]string{key, strconv.Itoa(value)})
+	}
+
+	fmt.Fprintf(out, "\nStatuses :\n")
+	statusTable.Render()
+
+	timeTable := tablewriter.NewWriter(out)
+	timeTable.SetHeader(append([]string{"Step", "Average duration"}, percentileHeaders()...))
+	timeTable.SetAlignment(tablewriter.ALIGN_CENTER)
+	for _, phase := range s.responseTimeline.phases() {
+		timeTable.Append(append(
+			[]string{phase.name, getAvgDuration(phase.duration, s.successRequests)},
+			s.timelineHistogram(phase.name).percentileRow()...,
+		))
+	}
+
+	fmt.Fprintf(out, "\nRequest details :\n")
+	timeTable.Render()
+
+	connTable := tablewriter.NewWriter(out)
+	connTable.SetAlignment(tablewriter.ALIGN_CENTER)
+	connTable.SetHeader([]string{
+		"Mode",
+		"New connections",
+		"Reused connections",
+		"Reuse ratio",
+		"Avg streams per connection",
+		"Max streams per connection",
+		"Max concurrent streams",
+	})
+	avgStreams, maxStreams, maxConcurrent := s.streamStats()
+	connTable.Append([]string{
+		s.opts.Connections,
+		strconv.Itoa(s.newConns),
+		strconv.Itoa(s.reusedConns),
+		fmt.Sprintf("%.1f%%", s.reuseRatio()*100),
+		fmt.Sprintf("%.1f", avgStreams),
+		strconv.Itoa(maxStreams),
+		strconv.Itoa(maxConcurrent),
+	})
+
+	fmt.Fprintf(out, "\nConnections :\n")
+	connTable.Render()
+
+	protoTable := tablewriter.NewWriter(out)
+	protoTable.SetAlignment(tablewriter.ALIGN_CENTER)
+	protoTable.SetHeader(append([]string{"Protocol", "Number of requests", "Average duration"}, percentileHeaders()...))
+	for _, proto := range sortedKeys(s.protocols) {
+		p := s.protocols[proto]
+		protoTable.Append(append(
+			[]string{proto, strconv.Itoa(p.requests), getAvgDuration(p.totalDuration, p.requests)},
+			p.histogram.percentileRow()...,
+		))
+	}
+
+	fmt.Fprintf(out, "\nProtocols :\n")
+	protoTable.Render()
+
+	s.renderTLS(out)
+
+	s.histogram.Render(out, "Duration")
+	for _, phase := range s.responseTimeline.phases() {
+		s.timelineHistogram(phase.name).Render(out, phase.name)
+	}
+
+	s.renderSchedule(out, s.opts.Rate)
+}
+
+// Summary returns the machine-readable results
+func (s *HTTPStats) Summary() *Summary {
+	s.Lock()
+	defer s.Unlock()
+	summary := newSummary(&s.DurationStats, s.nbOfRequests, s.statusStats, s.criticities)
+	summary.Errors += s.serverErrors
+	// The maps are copied, the summary is read while the requests are added
+	summary.StatusCodes = maps.Clone(s.statusCodes)
+	summary.Schedule = s.summary(s.opts.Rate)
+
+	avgSpeed := s.avgSpeed()
+	summary.TotalSize = &s.totalSize
+	summary.AvgSpeed = &avgSpeed
+
+	avgStreams, maxStreams, maxConcurrent := s.streamStats()
+	summary.Connections = &ConnectionsSummary{
+		New:                  s.newConns,
+		Reused:               s.reusedConns,
+		ReuseRatio:           s.reuseRatio(),
+		AvgStreams:           avgStreams,
+		MaxStreams:           maxStreams,
+		MaxConcurrentStreams: maxConcurrent,
+	}
+
+	summary.Protocols = map[string]ProtocolSummary{}
+	for proto, p := range s.protocols {
+		summary.Protocols[proto] = ProtocolSummary{
+			Requests:    p.requests,
+			AvgDuration: avgDuration(p.totalDuration, p.requests),
+			Percentiles: p.histogram.percentileMap(),
+		}
+	}
+
+	if len(s.tlsVersions) > 0 {
+		summary.TLS = &TLSSummary{
+			Versions:     maps.Clone(s.tlsVersions),
+			CipherSuites: maps.Clone(s.tlsCipherSuites),
+			ALPN:         maps.Clone(s.alpn),
+		}
+	}
+
+	summary.Timeline = map[string]StepSummary{}
+	for _, phase := range s.responseTimeline.phases() {
+		summary.Timeline[phase.name] = StepSummary{
+			AvgDuration: avgDuration(phase.duration, s.successRequests),
+			Percentiles: s.timelineHistogram(phase.name).percentileMap(),
+		}
+	}
+	return summary
+}
+
+// renderTLS renders the negotiated TLS parameters, if any request used TLS
+func (s *HTTPStats) renderTLS(out io.Writer) {
+	if len(s.tlsVersions) == 0 {
+		return
+	}
+	table := tablewriter.NewWriter(out)
+	table.SetAlignment(tablewriter.ALIGN_CENTER)
+	table.SetHeader([]string{"Parameter", "Value", "Count"})
+	for _, p := range []struct {
+		name   string
+		counts map[string]int
+	}{
+		{"Version", s.tlsVersions},
+		{"Cipher suite", s.tlsCipherSuites},
+		{"ALPN", s.alpn},
+	} {
+		for _, value := range sortedKeys(p.counts) {
+			table.Append([]string{p.name, value, strconv.Itoa(p.counts[value])})
+		}
+	}
+
+	fmt.Fprintf(out, "\nTLS :\n")
+	table.Render()
+}
+
+// streamStats returns the average and max number of streams per connection,
+// and the max number of streams in flight on a connection
+func (s *HTTPStats) streamStats() (float64, int, int) {
+	if len(s.connStreams) == 0 {
+		return 0, 0, 0
+	}
+	var total, max, maxConcurrent int
+	for _, c := range s.connStreams {
+		total += c.streams
+		if c.streams > max {
+			max = c.streams
+		}
+		if c.maxConcurrent > maxConcurrent {
+			maxConcurrent = c.maxConcurrent
+		}
+	}
+	return float64(total) / float64(len(s.connStreams)), max, maxConcurrent
+}
+
+// reuseRatio returns the ratio of requests made on a reused connection
+func (s *HTTPStats) reuseRatio() float64 {
+	if s.newConns+s.reusedConns == 0 {
+		return 0
+	}
+	return float64(s.reusedConns) / float64(s.newConns+s.reusedConns)
+}
+
+// avgSpeed returns the average speed in bytes per second
+func (s *HTTPStats) avgSpeed() float64 {
+	if s.execDuration == 0 {
+		return 0
+	}
+	return float64(s.totalSize) / s.execDuration.Seconds()
+}
+
+// timelineHistogram returns the histogram of a step of the timeline
+func (s *HTTPStats) timelineHistogram(name string) *Histogram {
+	if h, ok := s.timelineHistograms[name]; ok {
+		return h
+	}
+	return &Histogram{}
+}
+
+// SetDuration will set the total duration of the simulation
+func (s *HTTPStats) SetDuration(t time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.execDuration = t
+}
@@ -0,0 +1,87 @@
+package simulator
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHTTPStatsOtherRequests(t *testing.T) {
+	opts := DefaultOptions()
+	stats := NewHTTPStats(&opts)
+	stats.AddRequest(&DNSRequest{status: "NOERROR", criticity: Success, duration: 2 * time.Millisecond})
+	stats.AddRequest(&DNSRequest{criticity: Critical, duration: 4 * time.Millisecond, err: errors.New("timeout")})
+
+	s := stats.Summary()
+	if s.Requests != 2 || s.MinDuration != 2*time.Millisecond || s.MaxDuration != 4*time.Millisecond {
+		t.Errorf("Summary() = %d requests from %s to %s, want 2 requests from 2ms to 4ms", s.Requests, s.MinDuration, s.MaxDuration)
+	}
+	if s.Criticities["success"] != 1 || s.Criticities["critical"] != 1 {
+		t.Errorf("criticities = %v, want a success and a critical", s.Criticities)
+	}
+}
+
+func TestStreamStats(t *testing.T) {
+	// response returns a response on the connection, with the given number
+	// of streams in flight when it started
+	response := func(proto string, connID uint64, streams int) *HTTPRequest {
+		return &HTTPRequest{
+			criticity:        Success,
+			statusCode:       200,
+			duration:         time.Millisecond,
+			proto:            proto,
+			connID:           connID,
+			streams:          streams,
+			responseTimeline: &ResponseTimeline{},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		requests  []*HTTPRequest
+		want      ConnectionsSummary
+		protocols map[string]int
+	}{
+		{"no request", nil, ConnectionsSummary{}, map[string]int{}},
+		{
+			"HTTP/1.1 connections",
+			[]*HTTPRequest{response("HTTP/1.1", 1, 1), response("HTTP/1.1", 1, 1), response("HTTP/1.1", 2, 1)},
+			ConnectionsSummary{New: 3, AvgStreams: 1.5, MaxStreams: 2, MaxConcurrentStreams: 1},
+			map[string]int{"HTTP/1.1": 3},
+		},
+		{
+			"multiplexed connection",
+			[]*HTTPRequest{response("HTTP/2.0", 1, 1), response("HTTP/2.0", 1, 2), response("HTTP/2.0", 1, 3), response("HTTP/2.0", 1, 2)},
+			ConnectionsSummary{New: 4, AvgStreams: 4, MaxStreams: 4, MaxConcurrentStreams: 3},
+			map[string]int{"HTTP/2.0": 4},
+		},
+		{
+			"unknown connection",
+			[]*HTTPRequest{response("HTTP/2.0", 0, 0), response("HTTP/1.1", 1, 1)},
+			ConnectionsSummary{New: 2, AvgStreams: 1, MaxStreams: 1, MaxConcurrentStreams: 1},
+			map[string]int{"HTTP/2.0": 1, "HTTP/1.1": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			stats := NewHTTPStats(&opts)
+			for _, r := range tt.requests {
+				stats.AddRequest(r)
+			}
+
+			s := stats.Summary()
+			if *s.Connections != tt.want {
+				t.Errorf("connections = %+v, want %+v", *s.Connections, tt.want)
+			}
+			if len(s.Protocols) != len(tt.protocols) {
+				t.Errorf("protocols = %v, want %v", s.Protocols, tt.protocols)
+			}
+			for proto, requests := range tt.protocols {
+				if s.Protocols[proto].Requests != requests {
+					t.Errorf("%s requests = %d, want %d", proto, s.Protocols[proto].Requests, requests)
+				}
+			}
+		})
+	}
+}
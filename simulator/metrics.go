@@ -0,0 +1,191 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// metricsBuckets are the upper bounds in seconds of the latency histograms
+var metricsBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// requestLabels represents the labels of the request counters
+type requestLabels struct {
+	reqType string
+	status  string
+	err     string
+}
+
+// latencyHistogram represents a Prometheus histogram of latencies
+type latencyHistogram struct {
+	buckets []int64
+	count   int64
+	sum     float64
+}
+
+// Metrics exposes the live statistics of the run in the Prometheus text
+// format
+type Metrics struct {
+	sync.Mutex
+	requests      map[requestLabels]int64
+	sizes         map[string]int64
+	latencies     map[string]*latencyHistogram
+	inFlight      atomic.Int64
+	activeWorkers atomic.Int64
+	// server serves /metrics, once Serve is called, and served receives
+	// the error which stopped it
+	server *http.Server
+	served chan error
+}
+
+// NewMetrics returns empty Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:  map[requestLabels]int64{},
+		sizes:     map[string]int64{},
+		latencies: map[string]*latencyHistogram{},
+	}
+}
+
+// Serve starts listening on the given address and serves /metrics in the
+// background, until Shutdown is called
+func (m *Metrics) Serve(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	m.server = &http.Server{Handler: mux}
+	m.served = make(chan error, 1)
+	go func() {
+		m.served <- m.server.Serve(l)
+	}()
+	return nil
+}
+
+// Shutdown stops serving the metrics, the scrapes in progress are waited for
+// until the context is done, it returns the error which stopped serving them
+// if any
+func (m *Metrics) Shutdown(ctx context.Context) error {
+	if m.server == nil {
+		return nil
+	}
+	if err := m.server.Shutdown(ctx); err != nil {
+		return err
+	}
+	if err := <-m.served; err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// AddEvent adds a finished request to the metrics
+func (m *Metrics) AddEvent(e *Event) {
+	m.Lock()
+	defer m.Unlock()
+
+	status := e.Status
+	if e.StatusCode != 0 {
+		status = strconv.Itoa(e.StatusCode)
+	}
+	// The error class keeps the number of label values bounded, unlike the
+	// errors which may hold the URLs
+	errClass := e.ErrorClass
+	if e.Assertion != "" {
+		errClass = "assertion"
+	}
+	m.requests[requestLabels{reqType: e.Type, status: status, err: errClass}]++
+	m.sizes[e.Type] += e.Size
+
+	h, ok := m.latencies[e.Type]
+	if !ok {
+		h = &latencyHistogram{buckets: make([]int64, len(metricsBuckets))}
+		m.latencies[e.Type] = h
+	}
+	seconds := e.Duration.Seconds()
+	for i, bound := range metricsBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+// write writes the metrics in the Prometheus text format
+func (m *Metrics) write(w io.Writer) {
+	m.Lock()
+	defer m.Unlock()
+
+	fmt.Fprintln(w, "# HELP traffic_simulator_requests_total Number of requests made.")
+	fmt.Fprintln(w, "# TYPE traffic_simulator_requests_total counter")
+	labels := make([]requestLabels, 0, len(m.requests))
+	for l := range m.requests {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return fmt.Sprint(labels[i]) < fmt.Sprint(labels[j])
+	})
+	for _, l := range labels {
+		fmt.Fprintf(w, "traffic_simulator_requests_total{type=%s,status=%s,error=%s} %d\n",
+			quoteLabel(l.reqType), quoteLabel(l.status), quoteLabel(l.err), m.requests[l])
+	}
+
+	fmt.Fprintln(w, "# HELP traffic_simulator_response_size_bytes_total Number of bytes received.")
+	fmt.Fprintln(w, "# TYPE traffic_simulator_response_size_bytes_total counter")
+	for _, reqType := range sortedKeys(m.sizes) {
+		fmt.Fprintf(w, "traffic_simulator_response_size_bytes_total{type=%s} %d\n", quoteLabel(reqType), m.sizes[reqType])
+	}
+
+	fmt.Fprintln(w, "# HELP traffic_simulator_request_duration_seconds Duration of the requests.")
+	fmt.Fprintln(w, "# TYPE traffic_simulator_request_duration_seconds histogram")
+	for _, reqType := range sortedKeys(m.latencies) {
+		h := m.latencies[reqType]
+		for i, bound := range metricsBuckets {
+			fmt.Fprintf(w, "traffic_simulator_request_duration_seconds_bucket{type=%s,le=\"%s\"} %d\n",
+				quoteLabel(reqType), strconv.FormatFloat(bound, 'g', -1, 64), h.buckets[i])
+		}
+		fmt.Fprintf(w, "traffic_simulator_request_duration_seconds_bucket{type=%s,le=\"+Inf\"} %d\n", quoteLabel(reqType), h.count)
+		fmt.Fprintf(w, "traffic_simulator_request_duration_seconds_sum{type=%s} %g\n", quoteLabel(reqType), h.sum)
+		fmt.Fprintf(w, "traffic_simulator_request_duration_seconds_count{type=%s} %d\n", quoteLabel(reqType), h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP traffic_simulator_requests_in_flight Number of requests in flight.")
+	fmt.Fprintln(w, "# TYPE traffic_simulator_requests_in_flight gauge")
+	fmt.Fprintf(w, "traffic_simulator_requests_in_flight %d\n", m.inFlight.Load())
+
+	fmt.Fprintln(w, "# HELP traffic_simulator_active_workers Number of workers running.")
+	fmt.Fprintln(w, "# TYPE traffic_simulator_active_workers gauge")
+	fmt.Fprintf(w, "traffic_simulator_active_workers %d\n", m.activeWorkers.Load())
+}
+
+// quoteLabel returns the escaped and quoted value of a label
+func quoteLabel(v string) string {
+	r := strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	return `"` + r.Replace(v) + `"`
+}
+
+// sortedKeys returns the sorted keys of a map
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,268 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Traffic types
+const (
+	// HTTPTraffic makes the HTTP requests over HTTP/1.1, or HTTP/2 when
+	// negotiated with TLS
+	HTTPTraffic = "http"
+	// DNSTraffic resolves the hostnames of the URLs
+	DNSTraffic = "dns"
+)
+
+// Options represents the configuration of a run
+type Options struct {
+	// Type is the type of the requests: http, http2, dns, doh or dot
+	Type string
+	// Clients is the number of clients making requests, 10 if zero without
+	// a rate
+	Clients int
+	// Requests is the number of requests made by each client, or the total
+	// number of requests in rate mode, 10 if zero without a duration
+	Requests int
+	// Wait is the average time waited by a client between two requests, and
+	// WaitDistribution the distribution of the waits around it
+	Wait             time.Duration
+	WaitDistribution string
+	// Timeout is the timeout of each request, 3s if zero
+	Timeout        time.Duration
+	Seed           int64
+	FollowRedirect bool
+	// Rate is the number of requests per second dispatched regardless of the
+	// clients, 0 to disable the rate mode
+	Rate float64
+	// MaxInFlight is the maximum number of requests in flight in rate mode,
+	// 0 for unlimited
+	MaxInFlight int
+	// Duration is the duration of the run, it overrides Requests
+	Duration time.Duration
+	// Drain is the time given to the requests in flight to finish once the
+	// run is over or interrupted, they are aborted after it, at once if
+	// zero, 3s if negative
+	Drain time.Duration
+	// ClientsProfile and RateProfile are load profiles varying the number of
+	// clients or the rate, like "ramp:200:2m,hold:10m", they set the
+	// clients or the rate, and the duration
+	ClientsProfile string
+	RateProfile    string
+	// Connections is the connection mode of the HTTP requests, fresh by
+	// default and shared for http2
+	Connections string
+	// URLs are the URLs to test, the default ones if empty
+	URLs []URLEntry
+	// Method, Headers, Body and ContentType are the defaults of the HTTP
+	// requests, the URLs can override them
+	Method      string
+	Headers     map[string]string
+	Body        string
+	ContentType string
+	// DataFile is the filepath of a CSV file used by the {{csv "column"}}
+	// templates
+	DataFile string
+	TLS      TLSOptions
+	DNS      DNSOptions
+	// Thresholds are checked against the final stats, and during the run
+	// after AbortAfter for the ones aborting it
+	Thresholds []*Threshold
+	AbortAfter time.Duration
+	// Interval is the interval between the progress reports, 0 to disable
+	Interval time.Duration
+	// Params are the options of the traffic types registered outside of this
+	// package, checked by their Configure function
+	Params map[string]string
+	// Log is where each request is logged, nil to discard them
+	Log io.Writer
+	// Output is where the stats, the verdicts and the messages of the run
+	// are written, os.Stdout if nil
+	Output io.Writer
+}
+
+// TLSOptions represents the TLS configuration of the requests
+type TLSOptions struct {
+	Insecure bool
+	// CAFile is a PEM bundle of the CAs to trust instead of the system ones
+	CAFile string
+	// CertFile and KeyFile are a PEM client certificate and its key, for
+	// mutual TLS
+	CertFile   string
+	KeyFile    string
+	ServerName string
+	// MinVersion and MaxVersion are TLS versions like "1.2"
+	MinVersion string
+	MaxVersion string
+}
+
+// DNSOptions represents the configuration of the DNS queries
+type DNSOptions struct {
+	// Server is the host:port of the server queried in dns mode, the system
+	// resolver if empty, the URL of the server in doh mode, or its host[:port]
+	// in dot mode
+	Server string
+	// Transport is the transport of the queries in dns mode: udp or tcp
+	Transport string
+	// RecordType is the record type of the queries, like A or AAAA
+	RecordType string
+	// DoHMethod is the HTTP method of the queries in doh mode: GET or POST
+	DoHMethod string
+}
+
+// DefaultOptions returns the options of a run with the default values
+func DefaultOptions() Options {
+	return Options{
+		Type:             HTTPTraffic,
+		Clients:          10,
+		Requests:         10,
+		Wait:             time.Second,
+		WaitDistribution: ConstantWait,
+		Timeout:          3 * time.Second,
+		Drain:            3 * time.Second,
+		Seed:             time.Now().UTC().UnixNano(),
+		FollowRedirect:   true,
+		AbortAfter:       5 * time.Second,
+		DNS: DNSOptions{
+			Transport:  UDPTransport,
+			RecordType: "A",
+			DoHMethod:  http.MethodGet,
+		},
+	}
+}
+
+// normalize checks the options, fills the empty ones with their default and
+// returns the parsed think time and load profile, the options specific to the
+// traffic type are checked by it
+func (o *Options) normalize(trafficType TrafficType) (*ThinkTime, *Profile, error) {
+	defaults := DefaultOptions()
+	// A zero timeout would abort the requests at once, while a zero drain
+	// aborts the requests in flight as soon as the run is stopped
+	if o.Timeout == 0 {
+		o.Timeout = defaults.Timeout
+	}
+	if o.Drain < 0 {
+		o.Drain = defaults.Drain
+	}
+
+	if o.Connections == "" {
+		o.Connections = FreshConnections
+		// HTTP/2 multiplexes the requests of all the workers on shared
+		// connections
+		if o.Type == HTTP2Traffic {
+			o.Connections = SharedConnections
+		}
+	}
+	if err := CheckConnectionMode(o.Connections); err != nil {
+		return nil, nil, err
+	}
+
+	if o.DNS.Transport == "" {
+		o.DNS.Transport = defaults.DNS.Transport
+	}
+	if o.DNS.RecordType == "" {
+		o.DNS.RecordType = defaults.DNS.RecordType
+	}
+	o.DNS.RecordType = strings.ToUpper(o.DNS.RecordType)
+	if err := CheckDNSOptions(o.DNS.Transport, o.DNS.RecordType); err != nil {
+		return nil, nil, err
+	}
+	if o.DNS.DoHMethod == "" {
+		o.DNS.DoHMethod = defaults.DNS.DoHMethod
+	}
+	o.DNS.DoHMethod = strings.ToUpper(o.DNS.DoHMethod)
+
+	o.Method = strings.ToUpper(o.Method)
+	if o.Method != "" && !IsValidMethod(o.Method) {
+		return nil, nil, fmt.Errorf("invalid method %q", o.Method)
+	}
+
+	if o.WaitDistribution == "" {
+		o.WaitDistribution = defaults.WaitDistribution
+	}
+	thinkTime, err := ParseThinkTime(o.WaitDistribution, o.Wait)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid wait distribution: %s", err)
+	}
+
+	var profile *Profile
+	if o.ClientsProfile != "" && o.RateProfile != "" {
+		return nil, nil, errors.New("the clients profile and the rate profile can't be used together")
+	}
+	if spec := o.ClientsProfile + o.RateProfile; spec != "" {
+		if profile, err = ParseProfile(spec); err != nil {
+			return nil, nil, fmt.Errorf("invalid profile: %s", err)
+		}
+		if profile.max() <= 0 {
+			return nil, nil, errors.New("invalid profile: no stage has a positive target")
+		}
+		// The run lasts as long as the profile, with enough clients or the
+		// peak rate
+		o.Duration = profile.duration()
+		if o.RateProfile != "" {
+			o.Rate = profile.max()
+		} else {
+			o.Clients = int(math.Ceil(profile.max()))
+		}
+	}
+
+	// The run has the default clients without a rate, and makes the default
+	// requests without a duration
+	if o.Clients == 0 && o.Rate == 0 {
+		o.Clients = defaults.Clients
+	}
+	if o.Requests == 0 && o.Duration == 0 {
+		o.Requests = defaults.Requests
+	}
+	switch {
+	case o.Clients <= 0 && o.Rate <= 0:
+		return nil, nil, errors.New("the number of clients must be positive")
+	case o.Requests <= 0 && o.Duration <= 0:
+		return nil, nil, errors.New("the number of requests or the duration must be positive")
+	}
+
+	if len(o.URLs) == 0 {
+		o.URLs = DefaultURLs()
+	}
+	var totalWeight float64
+	for _, e := range o.URLs {
+		totalWeight += e.Weight
+	}
+	if totalWeight <= 0 {
+		return nil, nil, errors.New("at least one weight must be positive")
+	}
+
+	if trafficType.Configure != nil {
+		if err := trafficType.Configure(o); err != nil {
+			return nil, nil, err
+		}
+	}
+	return thinkTime, profile, nil
+}
+
+// output returns where the stats and the messages of the run are written
+func (o *Options) output() io.Writer {
+	if o.Output == nil {
+		return os.Stdout
+	}
+	return o.Output
+}
+
+// dnsTransportName returns the transport of the queries sent to the DNS
+// server
+func (o *Options) dnsTransportName() string {
+	switch o.Type {
+	case DoHTraffic:
+		return "https"
+	case DoTTraffic:
+		return "tls"
+	default:
+		return o.DNS.Transport
+	}
+}
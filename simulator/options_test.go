@@ -0,0 +1,99 @@
+package simulator
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestZeroOptions(t *testing.T) {
+	trafficGen, err := NewTrafficGenerator(Options{})
+	if err != nil {
+		t.Fatalf("NewTrafficGenerator() error = %s", err)
+	}
+	opts := trafficGen.Options()
+	defaults := DefaultOptions()
+	if opts.Type != HTTPTraffic || opts.Clients != defaults.Clients || opts.Requests != defaults.Requests {
+		t.Errorf("options = %s with %d clients and %d requests, want the defaults", opts.Type, opts.Clients, opts.Requests)
+	}
+	if opts.Timeout != defaults.Timeout {
+		t.Errorf("timeout = %s, want the default", opts.Timeout)
+	}
+	// A zero drain aborts the requests in flight at once
+	if opts.Drain != 0 {
+		t.Errorf("drain = %s, want 0 to be kept", opts.Drain)
+	}
+	if opts.FollowRedirect || opts.Seed != 0 {
+		t.Errorf("follow redirect = %v and seed = %d, want the zero values to be kept", opts.FollowRedirect, opts.Seed)
+	}
+	if opts.Connections != FreshConnections || opts.WaitDistribution != ConstantWait {
+		t.Errorf("connections = %q and wait distribution = %q, want the defaults", opts.Connections, opts.WaitDistribution)
+	}
+	if opts.DNS.Transport != UDPTransport || opts.DNS.RecordType != "A" || opts.DNS.DoHMethod != http.MethodGet {
+		t.Errorf("DNS options = %+v, want the defaults", opts.DNS)
+	}
+	if len(opts.URLs) == 0 {
+		t.Errorf("no URLs, want the default ones")
+	}
+}
+
+func TestNormalizeKeepsOptions(t *testing.T) {
+	opts := Options{
+		Type:     DNSTraffic,
+		Rate:     20,
+		Duration: time.Minute,
+		Timeout:  time.Second,
+		Drain:    time.Millisecond,
+		DNS:      DNSOptions{Transport: TCPTransport, RecordType: "aaaa"},
+	}
+	trafficGen, err := NewTrafficGenerator(opts)
+	if err != nil {
+		t.Fatalf("NewTrafficGenerator() error = %s", err)
+	}
+	got := trafficGen.Options()
+	if got.Clients != 0 || got.Requests != 0 {
+		t.Errorf("%d clients and %d requests, want none with a rate and a duration", got.Clients, got.Requests)
+	}
+	if got.Timeout != time.Second || got.Drain != time.Millisecond {
+		t.Errorf("timeout = %s and drain = %s, want the given ones", got.Timeout, got.Drain)
+	}
+	if got.DNS.Transport != TCPTransport || got.DNS.RecordType != "AAAA" {
+		t.Errorf("DNS options = %+v, want the given ones", got.DNS)
+	}
+}
+
+func TestNegativeDrain(t *testing.T) {
+	trafficGen, err := NewTrafficGenerator(Options{Drain: -1})
+	if err != nil {
+		t.Fatalf("NewTrafficGenerator() error = %s", err)
+	}
+	if got, want := trafficGen.Options().Drain, DefaultOptions().Drain; got != want {
+		t.Errorf("drain = %s, want the default %s", got, want)
+	}
+}
+
+func TestNormalizeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"negative clients", Options{Clients: -1}, "number of clients"},
+		{"negative requests", Options{Requests: -1}, "number of requests"},
+		{"connection mode", Options{Connections: "pooled"}, "unknown connection mode"},
+		{"DNS transport", Options{DNS: DNSOptions{Transport: "quic"}}, "unknown DNS transport"},
+		{"method", Options{Method: "GET /"}, "invalid method"},
+		{"both profiles", Options{ClientsProfile: "hold:1s", RateProfile: "hold:1s"}, "used together"},
+		{"weights", Options{URLs: []URLEntry{{URL: "example.com"}}}, "weight"},
+		{"DoH server", Options{Type: DoHTraffic, DNS: DNSOptions{Server: "dns.example"}}, "needs the URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTrafficGenerator(tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewTrafficGenerator() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package simulator
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// profileTick is the interval at which the target of the profile is checked,
+// to wake up the idle workers and to schedule the dispatches
+const profileTick = 10 * time.Millisecond
+
+// Kinds of stages
+const (
+	// RampStage goes linearly from the previous target to its target
+	RampStage = "ramp"
+	// HoldStage keeps the previous target
+	HoldStage = "hold"
+	// StepStage jumps to its target and keeps it
+	StepStage = "step"
+	// SpikeStage jumps to its target, then back to the previous target
+	SpikeStage = "spike"
+	// SineStage oscillates around its target, which is its base
+	SineStage = "sine"
+)
+
+// Stage represents a stage of a load profile
+type Stage struct {
+	Name     string
+	Kind     string
+	Target   float64
+	Duration time.Duration
+	// Amplitude and Period describe the wave of a sine stage
+	Amplitude float64
+	Period    time.Duration
+}
+
+// Profile represents a load profile, varying the number of clients or the
+// rate over time
+type Profile struct {
+	stages []Stage
+}
+
+// ParseProfile parses a load profile written as comma-separated stages like
+// "ramp:200:2m,hold:10m,spike:500:30s,ramp:0:1m", each stage can be named
+// like "warmup=ramp:200:2m". A sine stage is written sine:base:amplitude:period:duration
+func ParseProfile(spec string) (*Profile, error) {
+	p := &Profile{}
+	names := map[string]bool{}
+	for i, raw := range strings.Split(spec, ",") {
+		raw = strings.TrimSpace(raw)
+		name, def, ok := strings.Cut(raw, "=")
+		if !ok {
+			def = raw
+			name = ""
+		}
+
+		parts := strings.Split(def, ":")
+		stage := Stage{Name: name, Kind: parts[0]}
+		if stage.Name == "" {
+			stage.Name = fmt.Sprintf("%d-%s", i+1, stage.Kind)
+		}
+		if names[stage.Name] {
+			return nil, fmt.Errorf("stage %q: duplicate name %q", raw, stage.Name)
+		}
+		names[stage.Name] = true
+
+		var rawDuration string
+		switch stage.Kind {
+		case HoldStage:
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("stage %q: expected %s:duration", raw, stage.Kind)
+			}
+			rawDuration = parts[1]
+		case RampStage, StepStage, SpikeStage:
+			if len(parts) != 3 {
+				return nil, fmt.Errorf("stage %q: expected %s:target:duration", raw, stage.Kind)
+			}
+			target, err := strconv.ParseFloat(parts[1], 64)
+			if err != nil || target < 0 {
+				return nil, fmt.Errorf("stage %q: invalid target %q", raw, parts[1])
+			}
+			stage.Target = target
+			rawDuration = parts[2]
+		case SineStage:
+			if len(parts) != 5 {
+				return nil, fmt.Errorf("stage %q: expected %s:base:amplitude:period:duration", raw, stage.Kind)
+			}
+			base, err := strconv.ParseFloat(parts[1], 64)
+			if err != nil || base < 0 {
+				return nil, fmt.Errorf("stage %q: invalid base %q", raw, parts[1])
+			}
+			amplitude, err := strconv.ParseFloat(parts[2], 64)
+			if err != nil || amplitude < 0 {
+				return nil, fmt.Errorf("stage %q: invalid amplitude %q", raw, parts[2])
+			}
+			period, err := time.ParseDuration(parts[3])
+			if err != nil || period <= 0 {
+				return nil, fmt.Errorf("stage %q: invalid period %q", raw, parts[3])
+			}
+			stage.Target = base
+			stage.Amplitude = amplitude
+			stage.Period = period
+			rawDuration = parts[4]
+		default:
+			return nil, fmt.Errorf("stage %q: unknown kind %q", raw, stage.Kind)
+		}
+
+		d, err := time.ParseDuration(rawDuration)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("stage %q: invalid duration %q", raw, rawDuration)
+		}
+		stage.Duration = d
+		p.stages = append(p.stages, stage)
+	}
+	return p, nil
+}
+
+// duration returns the total duration of the profile
+func (p *Profile) duration() time.Duration {
+	var total time.Duration
+	for _, s := range p.stages {
+		total += s.Duration
+	}
+	return total
+}
+
+// max returns the highest target of the profile
+func (p *Profile) max() float64 {
+	var max float64
+	for _, s := range p.stages {
+		if s.Target+s.Amplitude > max {
+			max = s.Target + s.Amplitude
+		}
+	}
+	return max
+}
+
+// at returns the target and the stage at the given time since the start
+func (p *Profile) at(elapsed time.Duration) (float64, *Stage) {
+	var level float64
+	for i := range p.stages {
+		s := &p.stages[i]
+		if elapsed >= s.Duration && i < len(p.stages)-1 {
+			elapsed -= s.Duration
+			// Find the level at the end of the stage
+			switch s.Kind {
+			case RampStage, StepStage, SineStage:
+				level = s.Target
+			}
+			continue
+		}
+
+		switch s.Kind {
+		case RampStage:
+			progress := math.Min(1, float64(elapsed)/float64(s.Duration))
+			return level + (s.Target-level)*progress, s
+		case StepStage, SpikeStage:
+			return s.Target, s
+		case SineStage:
+			wave := math.Sin(2 * math.Pi * float64(elapsed) / float64(s.Period))
+			return math.Max(0, s.Target+s.Amplitude*wave), s
+		default:
+			return level, s
+		}
+	}
+	return level, nil
+}
+
+// stageStat represents the stats of a stage
+type stageStat struct {
+	requests      int
+	errors        int
+	totalDuration time.Duration
+	histogram     Histogram
+}
+
+// StageStats represents the stats of each stage of the profile
+type StageStats struct {
+	sync.Mutex
+	profile *Profile
+	stats   map[string]*stageStat
+}
+
+// newStageStats returns empty stats for the stages of the profile
+func newStageStats(p *Profile) *StageStats {
+	return &StageStats{
+		profile: p,
+		stats:   map[string]*stageStat{},
+	}
+}
+
+// AddRequest will add a request made during the given stage
+func (s *StageStats) AddRequest(stage string, req Request) {
+	s.Lock()
+	defer s.Unlock()
+	st, ok := s.stats[stage]
+	if !ok {
+		st = &stageStat{}
+		s.stats[stage] = st
+	}
+	st.requests++
+	if req.IsError() {
+		st.errors++
+	}
+	st.totalDuration += req.Duration()
+	st.histogram.Record(req.Duration())
+}
+
+// stat returns the stats of a stage
+func (s *StageStats) stat(stage string) *stageStat {
+	if st, ok := s.stats[stage]; ok {
+		return st
+	}
+	return &stageStat{}
+}
+
+// Render renders the stats of each stage
+func (s *StageStats) Render(out io.Writer) {
+	s.Lock()
+	defer s.Unlock()
+
+	table := tablewriter.NewWriter(out)
+	table.SetAlignment(tablewriter.ALIGN_CENTER)
+	table.SetHeader([]string{
+		"Stage",
+		"Target",
+		"Duration",
+		"Number of requests",
+		"Errors",
+		"Req/s",
+		"Average duration",
+		"p50",
+		"p99",
+	})
+	for _, stage := range s.profile.stages {
+		st := s.stat(stage.Name)
+		row := []string{
+			stage.Name,
+			strconv.FormatFloat(stage.Target, 'g', -1, 64),
+			stage.Duration.String(),
+			strconv.Itoa(st.requests),
+			strconv.Itoa(st.errors),
+			fmt.Sprintf("%.1f", float64(st.requests)/stage.Duration.Seconds()),
+			getAvgDuration(st.totalDuration, st.requests),
+			"NaN",
+			"NaN",
+		}
+		switch stage.Kind {
+		case HoldStage:
+			row[1] = "-"
+		case SineStage:
+			row[1] += "±" + strconv.FormatFloat(stage.Amplitude, 'g', -1, 64)
+		}
+		if st.requests > 0 {
+			row[7] = st.histogram.Percentile(50).String()
+			row[8] = st.histogram.Percentile(99).String()
+		}
+		table.Append(row)
+	}
+
+	fmt.Fprintf(out, "\nStages :\n")
+	table.Render()
+}
@@ -0,0 +1,120 @@
+package simulator
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProfile(t *testing.T) {
+	p, err := ParseProfile("warmup=ramp:200:2m, hold:10m,spike:500:30s,sine:100:50:1m:5m")
+	if err != nil {
+		t.Fatalf("ParseProfile() error = %s", err)
+	}
+	want := []Stage{
+		{Name: "warmup", Kind: RampStage, Target: 200, Duration: 2 * time.Minute},
+		{Name: "2-hold", Kind: HoldStage, Duration: 10 * time.Minute},
+		{Name: "3-spike", Kind: SpikeStage, Target: 500, Duration: 30 * time.Second},
+		{Name: "4-sine", Kind: SineStage, Target: 100, Amplitude: 50, Period: time.Minute, Duration: 5 * time.Minute},
+	}
+	if len(p.stages) != len(want) {
+		t.Fatalf("got %d stages, want %d", len(p.stages), len(want))
+	}
+	for i := range want {
+		if p.stages[i] != want[i] {
+			t.Errorf("stage %d = %+v, want %+v", i, p.stages[i], want[i])
+		}
+	}
+	if got := p.max(); got != 500 {
+		t.Errorf("max() = %v, want 500", got)
+	}
+	if got := p.duration(); got != 17*time.Minute+30*time.Second {
+		t.Errorf("duration() = %s, want 17m30s", got)
+	}
+}
+
+func TestParseProfileErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"ramp:200", "expected ramp:target:duration"},
+		{"hold:1:1m", "expected hold:duration"},
+		{"step:-1:1m", "invalid target"},
+		{"ramp:1:0s", "invalid duration"},
+		{"wave:1:1m", "unknown kind"},
+		{"a=hold:1m,a=hold:1m", "duplicate name"},
+		{"sine:100:50:1m", "expected sine:base:amplitude:period:duration"},
+		{"sine:-1:50:1m:5m", "invalid base"},
+		{"sine:100:x:1m:5m", "invalid amplitude"},
+		{"sine:100:50:0s:5m", "invalid period"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := ParseProfile(tt.spec)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseProfile() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileAt(t *testing.T) {
+	p, err := ParseProfile("ramp:100:10s,sine:100:50:20s:40s,sine:10:20:4s:4s,hold:10s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		elapsed time.Duration
+		want    float64
+		stage   string
+	}{
+		{0, 0, "1-ramp"},
+		{5 * time.Second, 50, "1-ramp"},
+		{10 * time.Second, 100, "2-sine"},
+		{15 * time.Second, 150, "2-sine"},
+		{25 * time.Second, 50, "2-sine"},
+		{30 * time.Second, 100, "2-sine"},
+		{53 * time.Second, 0, "3-sine"},
+		{55 * time.Second, 10, "4-hold"},
+	}
+	for _, tt := range tests {
+		got, stage := p.at(tt.elapsed)
+		if math.Abs(got-tt.want) > 1e-9 || stage == nil || stage.Name != tt.stage {
+			t.Errorf("at(%s) = %v in %v, want %v in %s", tt.elapsed, got, stage, tt.want, tt.stage)
+		}
+	}
+	if got := p.max(); got != 150 {
+		t.Errorf("max() = %v, want 150", got)
+	}
+}
+
+func TestWaitActive(t *testing.T) {
+	opts := DefaultOptions()
+	opts.ClientsProfile = "step:0:100ms,step:2:10s"
+	trafficGen, err := NewTrafficGenerator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trafficGen.start = time.Now()
+	stop := make(chan struct{})
+	defer close(stop)
+	go trafficGen.watchClients(stop)
+
+	// The second worker is woken up by the second stage
+	trafficGen.NewWorker(2).waitActive(context.Background())
+	if elapsed := time.Since(trafficGen.start); elapsed < 100*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("the worker waited %s, want it woken up after 100ms", elapsed)
+	}
+
+	// The third worker is never needed, it waits until the context is
+	// canceled
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	trafficGen.NewWorker(3).waitActive(ctx)
+	if ctx.Err() == nil {
+		t.Errorf("waitActive() returned before the context was canceled")
+	}
+}
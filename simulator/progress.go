@@ -0,0 +1,87 @@
+package simulator
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Progress represents the rolling stats of the current reporting window
+type Progress struct {
+	sync.Mutex
+	histogram   Histogram
+	requests    int
+	errors      int
+	size        int64
+	windowStart time.Time
+	runStart    time.Time
+	logger      *log.Logger
+}
+
+// newProgress returns an empty Progress with a window starting now, its
+// reports are written to the logger
+func newProgress(logger *log.Logger) *Progress {
+	now := time.Now()
+	return &Progress{
+		windowStart: now,
+		runStart:    now,
+		logger:      logger,
+	}
+}
+
+// AddRequest will add a request to the current window
+func (p *Progress) AddRequest(req Request) {
+	p.Lock()
+	defer p.Unlock()
+	p.requests++
+	p.size += req.Size()
+	p.histogram.Record(req.Duration())
+	if req.IsError() {
+		p.errors++
+	}
+}
+
+// report prints the stats of the current window and starts a new one
+func (p *Progress) report() {
+	p.Lock()
+	now := time.Now()
+	window := now.Sub(p.windowStart).Seconds()
+	elapsed := now.Sub(p.runStart).Round(time.Second)
+	requests, errors, size := p.requests, p.errors, p.size
+	p50, p99 := p.histogram.Percentile(50), p.histogram.Percentile(99)
+
+	p.histogram = Histogram{}
+	p.requests, p.errors, p.size = 0, 0, 0
+	p.windowStart = now
+	p.Unlock()
+
+	var errorRate float64
+	if requests > 0 {
+		errorRate = float64(errors) / float64(requests) * 100
+	}
+
+	p.logger.Printf("Progress %s | %.1f req/s | errors %.1f%% | p50 %s | p99 %s | %s/s",
+		elapsed,
+		float64(requests)/window,
+		errorRate,
+		p50.Round(time.Microsecond),
+		p99.Round(time.Microsecond),
+		humanize.Bytes(uint64(float64(size)/window)),
+	)
+}
+
+// reportEvery prints the progress at each interval, until stop is closed
+func (p *Progress) reportEvery(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.report()
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package simulator
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressReport(t *testing.T) {
+	tests := []struct {
+		name     string
+		requests []Request
+		want     string
+	}{
+		{
+			"empty window",
+			nil,
+			"Progress 10s | 0.0 req/s | errors 0.0% | p50 0s | p99 0s | 0 B/s",
+		},
+		{
+			"successes",
+			[]Request{
+				&HTTPRequest{criticity: Success, duration: 10 * time.Millisecond, size: 1000},
+				&HTTPRequest{criticity: Success, duration: 10 * time.Millisecond, size: 1000},
+				&HTTPRequest{criticity: Success, duration: 10 * time.Millisecond, size: 1000},
+				&HTTPRequest{criticity: Success, duration: 10 * time.Millisecond, size: 1000},
+			},
+			"Progress 10s | 2.0 req/s | errors 0.0% | p50 10ms | p99 10ms | 2.0 kB/s",
+		},
+		{
+			"errors",
+			[]Request{
+				&HTTPRequest{criticity: Success, duration: 10 * time.Millisecond, size: 4000},
+				&HTTPRequest{criticity: Critical, duration: 10 * time.Millisecond, err: errors.New("timeout")},
+				&HTTPRequest{criticity: Success, duration: 10 * time.Millisecond},
+				&HTTPRequest{criticity: Success, duration: 10 * time.Millisecond},
+			},
+			"Progress 10s | 2.0 req/s | errors 25.0% | p50 10ms | p99 10ms | 2.0 kB/s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			p := newProgress(log.New(&out, "", 0))
+			// A 2s window of a run started 10s ago
+			now := time.Now()
+			p.runStart, p.windowStart = now.Add(-10*time.Second), now.Add(-2*time.Second)
+			for _, req := range tt.requests {
+				p.AddRequest(req)
+			}
+
+			p.report()
+			if got := strings.TrimSpace(out.String()); got != tt.want {
+				t.Errorf("report() = %q, want %q", got, tt.want)
+			}
+			if p.requests != 0 || p.errors != 0 || p.size != 0 || p.histogram.Count() != 0 {
+				t.Errorf("report() kept the window, want a new one")
+			}
+		})
+	}
+}
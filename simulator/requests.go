@@ -0,0 +1,81 @@
+package simulator
+
+import (
+	"context"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const (
+	// Success is a successful request
+	Success CriticityLevel = iota
+	// Warning is a successful request but with a bad status
+	Warning
+	// Critical is an unsuccessful request
+	Critical
+	// Failed is a response failing the assertions of its URL
+	Failed
+	// Interrupted is a request aborted when the run is stopped, it is not
+	// counted in the stats
+	Interrupted
+)
+
+// CriticityLevel represents the criticity level of a request
+type CriticityLevel int
+
+// Colors
+var red = color.New(color.FgRed).SprintfFunc()
+var green = color.New(color.FgGreen).SprintfFunc()
+var yellow = color.New(color.FgYellow).SprintfFunc()
+var magenta = color.New(color.FgMagenta).SprintfFunc()
+var cyan = color.New(color.FgCyan).SprintfFunc()
+
+var criticityName = map[CriticityLevel]string{
+	Success:     "success",
+	Warning:     "warning",
+	Critical:    "critical",
+	Failed:      "failed",
+	Interrupted: "interrupted",
+}
+
+var criticityColor = map[CriticityLevel]func(string, ...interface{}) string{
+	Success:     green,
+	Warning:     yellow,
+	Critical:    red,
+	Failed:      magenta,
+	Interrupted: cyan,
+}
+
+// Request represents a Request interface
+type Request interface {
+	String() string
+	Error() string
+	IsError() bool
+	Status() string
+	Size() int64
+	Duration() time.Duration
+	Criticity() CriticityLevel
+	// AddDelay adds the time spent waiting to be dispatched in rate mode
+	AddDelay(time.Duration)
+	// Event returns the event written to the event log, NewEvent fills its
+	// common fields
+	Event() *Event
+}
+
+// errorCriticity returns the criticity of a request which failed with the
+// given context, it is interrupted if the context is canceled
+func errorCriticity(ctx context.Context) CriticityLevel {
+	if ctx.Err() != nil {
+		return Interrupted
+	}
+	return Critical
+}
+
+// errorLabel returns the label of a request which failed in the logs
+func errorLabel(criticity CriticityLevel) string {
+	if criticity == Interrupted {
+		return cyan("INTERRUPTED")
+	}
+	return red("ERR")
+}
@@ -0,0 +1,116 @@
+package simulator
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// lateDispatchTolerance is the delay after which a dispatch is considered late
+const lateDispatchTolerance = time.Millisecond
+
+// Stats represents a statistics interface
+type Stats interface {
+	AddRequest(Request)
+	AddDispatch(time.Duration)
+	AddMissed()
+	Render()
+	Summary() *Summary
+	SetDuration(time.Duration)
+}
+
+// DurationStats represents statistics of durations
+type DurationStats struct {
+	maxDuration   time.Duration
+	minDuration   time.Duration
+	totalDuration time.Duration
+	execDuration  time.Duration
+	histogram     Histogram
+}
+
+// ScheduleStats represents statistics of the dispatches in rate mode
+type ScheduleStats struct {
+	mu            sync.Mutex
+	dispatched    int
+	late          int
+	missed        int
+	maxLateness   time.Duration
+	totalLateness time.Duration
+}
+
+// record will add a duration to the stats
+func (s *DurationStats) record(d time.Duration) {
+	s.totalDuration += d
+	if s.maxDuration < d {
+		s.maxDuration = d
+	}
+	if s.minDuration == 0 || s.minDuration > d {
+		s.minDuration = d
+	}
+	s.histogram.Record(d)
+}
+
+// renderPercentiles renders the percentiles of the durations
+func (s *DurationStats) renderPercentiles(out io.Writer) {
+	table := tablewriter.NewWriter(out)
+	table.SetAlignment(tablewriter.ALIGN_CENTER)
+	table.SetHeader(percentileHeaders())
+	table.Append(s.histogram.percentileRow())
+
+	fmt.Fprintf(out, "\nPercentiles :\n")
+	table.Render()
+}
+
+// AddDispatch will add a dispatch made with the given lateness to the stats
+func (s *ScheduleStats) AddDispatch(lateness time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dispatched++
+	s.totalLateness += lateness
+	if lateness > lateDispatchTolerance {
+		s.late++
+	}
+	if s.maxLateness < lateness {
+		s.maxLateness = lateness
+	}
+}
+
+// AddMissed will add a dispatch skipped because too many requests were in
+// flight
+func (s *ScheduleStats) AddMissed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.missed++
+}
+
+// renderSchedule renders the dispatch results, only in rate mode
+func (s *ScheduleStats) renderSchedule(out io.Writer, rate float64) {
+	if rate <= 0 {
+		return
+	}
+	table := tablewriter.NewWriter(out)
+	table.SetAlignment(tablewriter.ALIGN_CENTER)
+	table.SetHeader([]string{
+		"Target rate",
+		"Dispatched",
+		"Late",
+		"Missed",
+		"Average lateness",
+		"Max lateness",
+	})
+	table.Append([]string{
+		fmt.Sprintf("%g req/s", rate),
+		strconv.Itoa(s.dispatched),
+		strconv.Itoa(s.late),
+		strconv.Itoa(s.missed),
+		getAvgDuration(s.totalLateness, s.dispatched),
+		s.maxLateness.String(),
+	})
+
+	fmt.Fprintf(out, "\nSchedule :\n")
+	table.Render()
+}
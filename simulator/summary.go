@@ -0,0 +1,335 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// summaryVersion is the version of the summary format, it must be increased
+// on every breaking change
+const summaryVersion = 1
+
+// Summary represents the machine-readable results of a run
+type Summary struct {
+	Version      int                        `json:"version"`
+	Type         string                     `json:"type"`
+	Seed         int64                      `json:"seed"`
+	Config       RunConfig                  `json:"config"`
+	Requests     int                        `json:"requests"`
+	Interrupted  int                        `json:"interrupted"`
+	Errors       int                        `json:"errors"`
+	MinDuration  time.Duration              `json:"min_duration_ns"`
+	MaxDuration  time.Duration              `json:"max_duration_ns"`
+	AvgDuration  time.Duration              `json:"avg_duration_ns"`
+	ExecDuration time.Duration              `json:"exec_duration_ns"`
+	Percentiles  map[string]time.Duration   `json:"percentiles_ns"`
+	TotalSize    *int64                     `json:"total_size_bytes,omitempty"`
+	AvgSpeed     *float64                   `json:"avg_speed_bytes_per_second,omitempty"`
+	Statuses     map[string]int             `json:"statuses"`
+	StatusCodes  map[string]int             `json:"status_codes,omitempty"`
+	Criticities  map[string]int             `json:"criticities"`
+	Timeline     map[string]StepSummary     `json:"timeline,omitempty"`
+	Connections  *ConnectionsSummary        `json:"connections,omitempty"`
+	TLS          *TLSSummary                `json:"tls,omitempty"`
+	Protocols    map[string]ProtocolSummary `json:"protocols,omitempty"`
+	DNS          *DNSSummary                `json:"dns,omitempty"`
+	Schedule     *ScheduleSummary           `json:"schedule,omitempty"`
+	Stages       []StageSummary             `json:"stages,omitempty"`
+	Thresholds   []ThresholdResult          `json:"thresholds,omitempty"`
+}
+
+// RunConfig represents the configuration of a run
+type RunConfig struct {
+	Clients        int               `json:"clients"`
+	Requests       int               `json:"requests"`
+	Wait           int               `json:"wait_ms"`
+	WaitDist       string            `json:"wait_distribution"`
+	Timeout        int               `json:"timeout_s"`
+	FollowRedirect bool              `json:"follow_redirect"`
+	TLSInsecure    bool              `json:"tls_insecure"`
+	TLSServerName  string            `json:"tls_server_name"`
+	TLSMinVersion  string            `json:"tls_min_version"`
+	TLSMaxVersion  string            `json:"tls_max_version"`
+	Connections    string            `json:"connections"`
+	Method         string            `json:"method"`
+	Rate           float64           `json:"rate"`
+	MaxInFlight    int               `json:"max_in_flight"`
+	Duration       time.Duration     `json:"duration_ns"`
+	Drain          time.Duration     `json:"drain_ns"`
+	DNSServer      string            `json:"dns_server"`
+	DNSTransport   string            `json:"dns_transport"`
+	RecordType     string            `json:"record_type"`
+	URLSource      string            `json:"url_source"`
+	DataFile       string            `json:"data_file"`
+	ConfigFile     string            `json:"config_file"`
+	ClientsProfile string            `json:"clients_profile"`
+	RateProfile    string            `json:"rate_profile"`
+	Params         map[string]string `json:"params,omitempty"`
+}
+
+// StepSummary represents the results of a step of the response timeline
+type StepSummary struct {
+	AvgDuration time.Duration            `json:"avg_duration_ns"`
+	Percentiles map[string]time.Duration `json:"percentiles_ns"`
+}
+
+// ConnectionsSummary represents the reuse of the HTTP connections
+type ConnectionsSummary struct {
+	New                  int     `json:"new"`
+	Reused               int     `json:"reused"`
+	ReuseRatio           float64 `json:"reuse_ratio"`
+	AvgStreams           float64 `json:"avg_streams_per_connection"`
+	MaxStreams           int     `json:"max_streams_per_connection"`
+	MaxConcurrentStreams int     `json:"max_concurrent_streams"`
+}
+
+// ProtocolSummary represents the results of the responses of a protocol
+type ProtocolSummary struct {
+	Requests    int                      `json:"requests"`
+	AvgDuration time.Duration            `json:"avg_duration_ns"`
+	Percentiles map[string]time.Duration `json:"percentiles_ns"`
+}
+
+// TLSSummary represents the number of requests made with each negotiated TLS
+// parameter
+type TLSSummary struct {
+	Versions     map[string]int `json:"versions"`
+	CipherSuites map[string]int `json:"cipher_suites"`
+	ALPN         map[string]int `json:"alpn"`
+}
+
+// DNSSummary represents the responses of the queries sent to a DNS server
+type DNSSummary struct {
+	Responses int `json:"responses"`
+	Answers   int `json:"answers"`
+	Truncated int `json:"truncated"`
+}
+
+// ScheduleSummary represents the results of the dispatches in rate mode
+type ScheduleSummary struct {
+	Dispatched  int           `json:"dispatched"`
+	Late        int           `json:"late"`
+	Missed      int           `json:"missed"`
+	AvgLateness time.Duration `json:"avg_lateness_ns"`
+	MaxLateness time.Duration `json:"max_lateness_ns"`
+}
+
+// StageSummary represents the results of a stage of the load profile
+type StageSummary struct {
+	Name        string                   `json:"name"`
+	Kind        string                   `json:"kind"`
+	Target      float64                  `json:"target"`
+	Amplitude   float64                  `json:"amplitude,omitempty"`
+	Period      time.Duration            `json:"period_ns,omitempty"`
+	Duration    time.Duration            `json:"duration_ns"`
+	Requests    int                      `json:"requests"`
+	Errors      int                      `json:"errors"`
+	AvgDuration time.Duration            `json:"avg_duration_ns"`
+	Percentiles map[string]time.Duration `json:"percentiles_ns"`
+}
+
+// newSummary returns a summary filled with the duration stats, the
+// configuration of the run is added by the traffic generator
+func newSummary(d *DurationStats, count int, statuses, criticities map[string]int) *Summary {
+	s := &Summary{
+		Requests:     count,
+		Errors:       criticities[criticityName[Critical]] + criticities[criticityName[Failed]],
+		MinDuration:  d.minDuration,
+		MaxDuration:  d.maxDuration,
+		AvgDuration:  avgDuration(d.totalDuration, count),
+		ExecDuration: d.execDuration,
+		Percentiles:  d.histogram.percentileMap(),
+		Statuses:     map[string]int{},
+		Criticities:  map[string]int{},
+	}
+	for _, name := range criticityName {
+		s.Criticities[name] = criticities[name]
+	}
+	for key, value := range statuses {
+		s.Statuses[strings.TrimSpace(key)] = value
+	}
+	return s
+}
+
+// summary returns the summary of the dispatches, only in rate mode
+func (s *ScheduleStats) summary(rate float64) *ScheduleSummary {
+	if rate <= 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &ScheduleSummary{
+		Dispatched:  s.dispatched,
+		Late:        s.late,
+		Missed:      s.missed,
+		AvgLateness: avgDuration(s.totalLateness, s.dispatched),
+		MaxLateness: s.maxLateness,
+	}
+}
+
+// summary returns the summary of each stage
+func (s *StageStats) summary() []StageSummary {
+	s.Lock()
+	defer s.Unlock()
+	summaries := []StageSummary{}
+	for _, stage := range s.profile.stages {
+		st := s.stat(stage.Name)
+		summaries = append(summaries, StageSummary{
+			Name:        stage.Name,
+			Kind:        stage.Kind,
+			Target:      stage.Target,
+			Amplitude:   stage.Amplitude,
+			Period:      stage.Period,
+			Duration:    stage.Duration,
+			Requests:    st.requests,
+			Errors:      st.errors,
+			AvgDuration: avgDuration(st.totalDuration, st.requests),
+			Percentiles: st.histogram.percentileMap(),
+		})
+	}
+	return summaries
+}
+
+// percentileMap returns the percentiles of the histogram by name
+func (h *Histogram) percentileMap() map[string]time.Duration {
+	m := map[string]time.Duration{}
+	for i, name := range percentileHeaders() {
+		m[name] = h.Percentile(percentiles[i])
+	}
+	return m
+}
+
+// Summary returns the machine-readable results of the run, with its
+// configuration
+func (trafficGen *TrafficGenerator) Summary() *Summary {
+	opts := &trafficGen.opts
+	summary := trafficGen.stats.Summary()
+	summary.Version = summaryVersion
+	summary.Type = opts.Type
+	summary.Seed = opts.Seed
+	summary.Config = RunConfig{
+		Clients:        opts.Clients,
+		Requests:       opts.Requests,
+		Wait:           int(opts.Wait.Milliseconds()),
+		WaitDist:       opts.WaitDistribution,
+		Timeout:        int(opts.Timeout.Seconds()),
+		FollowRedirect: opts.FollowRedirect,
+		TLSInsecure:    opts.TLS.Insecure,
+		TLSServerName:  opts.TLS.ServerName,
+		TLSMinVersion:  opts.TLS.MinVersion,
+		TLSMaxVersion:  opts.TLS.MaxVersion,
+		Connections:    opts.Connections,
+		Method:         opts.Method,
+		Rate:           opts.Rate,
+		MaxInFlight:    opts.MaxInFlight,
+		Duration:       opts.Duration,
+		Drain:          opts.Drain,
+		DNSServer:      opts.DNS.Server,
+		DNSTransport:   opts.dnsTransportName(),
+		RecordType:     opts.DNS.RecordType,
+		DataFile:       opts.DataFile,
+		ClientsProfile: opts.ClientsProfile,
+		RateProfile:    opts.RateProfile,
+		Params:         opts.Params,
+	}
+	if trafficGen.stages != nil {
+		summary.Stages = trafficGen.stages.summary()
+	}
+	summary.Interrupted = int(trafficGen.interrupted.Load())
+	summary.Criticities[criticityName[Interrupted]] = summary.Interrupted
+	summary.Thresholds = trafficGen.results
+	return summary
+}
+
+// WriteFile writes the summary to the given file, in CSV if the file has a
+// .csv extension, in JSON otherwise
+func (summary *Summary) WriteFile(path string) error {
+	data, err := summary.marshal(strings.EqualFold(filepath.Ext(path), ".csv"))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// marshal returns the summary in CSV or in JSON
+func (summary *Summary) marshal(asCSV bool) ([]byte, error) {
+	// Keep the operators of the thresholds readable
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(summary); err != nil {
+		return nil, err
+	}
+	if asCSV {
+		return summaryToCSV(buf.Bytes())
+	}
+	return buf.Bytes(), nil
+}
+
+// csvKeyEscaper escapes the separator of the CSV keys as in a JSON Pointer,
+// the keys like "p99.9" or "HTTP/1.1" may contain dots and slashes
+var csvKeyEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// summaryToCSV flattens the JSON summary into key,value rows, the keys of
+// nested objects and the indexes of the lists are joined with slashes, the
+// slashes and tildes of the keys being escaped as ~1 and ~0
+func summaryToCSV(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	rows := [][]string{}
+	var flatten func(prefix string, v interface{})
+	flatten = func(prefix string, v interface{}) {
+		switch e := v.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(e))
+			for key := range e {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				name := csvKeyEscaper.Replace(key)
+				if prefix != "" {
+					name = prefix + "/" + name
+				}
+				flatten(name, e[key])
+			}
+		case []interface{}:
+			for i, item := range e {
+				flatten(prefix+"/"+strconv.Itoa(i), item)
+			}
+		case json.Number:
+			rows = append(rows, []string{prefix, e.String()})
+		case string:
+			rows = append(rows, []string{prefix, e})
+		case bool:
+			rows = append(rows, []string{prefix, strconv.FormatBool(e)})
+		}
+	}
+	flatten("", v)
+
+	// Keep the version first so the format can be checked before parsing
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i][0] == "version" && rows[j][0] != "version" })
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write([]string{"key", "value"}); err != nil {
+		return nil, err
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
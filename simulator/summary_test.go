@@ -0,0 +1,75 @@
+package simulator
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// goldenSummary returns a summary with the fields whose keys need escaping
+func goldenSummary() *Summary {
+	size := int64(2048)
+	return &Summary{
+		Version:      summaryVersion,
+		Type:         HTTPTraffic,
+		Seed:         42,
+		Config:       RunConfig{Clients: 2, Requests: 3, Timeout: 3, Method: "GET", Connections: SharedConnections},
+		Requests:     6,
+		Interrupted:  1,
+		MinDuration:  time.Millisecond,
+		MaxDuration:  5 * time.Millisecond,
+		AvgDuration:  2 * time.Millisecond,
+		ExecDuration: time.Second,
+		Percentiles:  map[string]time.Duration{"p50": 2 * time.Millisecond, "p99.9": 5 * time.Millisecond},
+		TotalSize:    &size,
+		Statuses:     map[string]int{"OK": 5, "Not Found": 1},
+		StatusCodes:  map[string]int{"200": 5, "404": 1},
+		Criticities:  map[string]int{"success": 5, "warning": 1, "interrupted": 1},
+		Protocols: map[string]ProtocolSummary{
+			"HTTP/1.1": {Requests: 6, AvgDuration: 2 * time.Millisecond},
+		},
+		Thresholds: []ThresholdResult{
+			{Threshold: "p99<300ms", Value: "5ms", Passed: true},
+		},
+	}
+}
+
+func TestSummaryGolden(t *testing.T) {
+	for _, ext := range []string{".json", ".csv"} {
+		t.Run(ext, func(t *testing.T) {
+			got, err := goldenSummary().marshal(ext == ".csv")
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", "summary"+ext)
+			if *update {
+				if err := os.WriteFile(path, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("summary differs from %s, run with -update if expected:\n%s", path, got)
+			}
+		})
+	}
+}
+
+func TestCSVKeysAreEscaped(t *testing.T) {
+	data, err := summaryToCSV([]byte(`{"a/b": {"c~d": 1, "e.f": [true]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "key,value\na~1b/c~0d,1\na~1b/e.f/0,true\n"
+	if string(data) != want {
+		t.Errorf("summaryToCSV() = %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,334 @@
+package simulator
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// templateSet represents the compiled templates of the requests of a run, and
+// the content of its data file
+type templateSet struct {
+	// templates holds the compiled templates of the options, by source
+	templates map[string]*requestTemplate
+	// dataColumns and dataRows hold the content of the data file
+	dataColumns map[string]int
+	dataRows    [][]string
+}
+
+// templateFunc represents a function usable in a template, like
+// {{randInt 1 10000}}
+type templateFunc struct {
+	args []string
+	call func(vars *RequestVars, args []templateArg) string
+}
+
+// templateFuncs holds the functions usable in the templates, with the type of
+// their arguments
+var templateFuncs = map[string]templateFunc{
+	"randInt": {
+		args: []string{"int", "int"},
+		call: func(vars *RequestVars, args []templateArg) string {
+			min, max := args[0].int, args[1].int
+			return strconv.Itoa(min + vars.Rand().Intn(max-min+1))
+		},
+	},
+	"randString": {
+		args: []string{"int"},
+		call: func(vars *RequestVars, args []templateArg) string {
+			const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+			b := make([]byte, args[0].int)
+			for i := range b {
+				b[i] = letters[vars.Rand().Intn(len(letters))]
+			}
+			return string(b)
+		},
+	},
+	"uuid": {
+		call: func(vars *RequestVars, _ []templateArg) string {
+			var b [16]byte
+			vars.Rand().Read(b[:])
+			// Version 4, variant RFC 4122
+			b[6] = b[6]&0x0f | 0x40
+			b[8] = b[8]&0x3f | 0x80
+			return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+		},
+	},
+	"workerID": {
+		call: func(vars *RequestVars, _ []templateArg) string {
+			return strconv.Itoa(vars.worker)
+		},
+	},
+	"seq": {
+		call: func(vars *RequestVars, _ []templateArg) string {
+			return strconv.Itoa(vars.seq)
+		},
+	},
+	"csv": {
+		args: []string{"string"},
+		call: func(vars *RequestVars, args []templateArg) string {
+			return vars.dataRow()[vars.templates.dataColumns[args[0].str]]
+		},
+	},
+}
+
+// templateArg represents an argument of a function call
+type templateArg struct {
+	int int
+	str string
+}
+
+// templatePart represents a literal text, or a function call if fn is set
+type templatePart struct {
+	text string
+	fn   *templateFunc
+	args []templateArg
+}
+
+// requestTemplate represents a compiled template
+type requestTemplate struct {
+	parts []templatePart
+}
+
+// RequestVars represents the variables of a request, used to evaluate its
+// templates
+type RequestVars struct {
+	templates *templateSet
+	worker    int
+	seq       int
+	// rng is created from seed when it is first needed, unless it is given
+	rng  *rand.Rand
+	seed int64
+	// row is the row of the data file picked for the request
+	row []string
+}
+
+// Rand returns the random generator of the request, which only depends on
+// the seed of the run
+func (vars *RequestVars) Rand() *rand.Rand {
+	if vars.rng == nil {
+		vars.rng = rand.New(rand.NewSource(vars.seed))
+	}
+	return vars.rng
+}
+
+// dataRow returns the row of the data file of the request, the same row is
+// used by all the templates of the request
+func (vars *RequestVars) dataRow() []string {
+	if vars.row == nil {
+		rows := vars.templates.dataRows
+		vars.row = rows[vars.Rand().Intn(len(rows))]
+	}
+	return vars.row
+}
+
+// newTemplateSet loads the data file and compiles the templates of the URLs,
+// headers and bodies of the options
+func newTemplateSet(opts *Options) (*templateSet, error) {
+	set := &templateSet{
+		templates:   map[string]*requestTemplate{},
+		dataColumns: map[string]int{},
+	}
+	if opts.DataFile != "" {
+		if err := set.loadDataFile(opts.DataFile); err != nil {
+			return nil, fmt.Errorf("data file: %s", err)
+		}
+	}
+
+	sources := []string{opts.Body}
+	for _, value := range opts.Headers {
+		sources = append(sources, value)
+	}
+	for _, entry := range opts.URLs {
+		sources = append(sources, entry.URL, entry.Body)
+		for _, value := range entry.Headers {
+			sources = append(sources, value)
+		}
+	}
+
+	for _, source := range sources {
+		if !strings.Contains(source, "{{") || set.templates[source] != nil {
+			continue
+		}
+		t, err := set.parseTemplate(source)
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %s", source, err)
+		}
+		set.templates[source] = t
+	}
+	return set, nil
+}
+
+// parseTemplate parses a text holding function calls like {{randInt 1 10}}
+func (set *templateSet) parseTemplate(source string) (*requestTemplate, error) {
+	t := &requestTemplate{}
+	rest := source
+	for rest != "" {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			t.parts = append(t.parts, templatePart{text: rest})
+			break
+		}
+		if start > 0 {
+			t.parts = append(t.parts, templatePart{text: rest[:start]})
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed action at offset %d", len(source)-len(rest)+start)
+		}
+		part, err := set.parseTemplateCall(rest[start+2 : start+end])
+		if err != nil {
+			return nil, err
+		}
+		t.parts = append(t.parts, part)
+		rest = rest[start+end+2:]
+	}
+	return t, nil
+}
+
+// parseTemplateCall parses the content of an action, a function name followed
+// by its arguments
+func (set *templateSet) parseTemplateCall(action string) (templatePart, error) {
+	words, err := splitTemplateAction(action)
+	if err != nil {
+		return templatePart{}, err
+	}
+	if len(words) == 0 {
+		return templatePart{}, fmt.Errorf("empty action")
+	}
+	fn, ok := templateFuncs[words[0]]
+	if !ok {
+		return templatePart{}, fmt.Errorf("unknown function %q", words[0])
+	}
+	if len(words)-1 != len(fn.args) {
+		return templatePart{}, fmt.Errorf("%s expects %d arguments, got %d", words[0], len(fn.args), len(words)-1)
+	}
+
+	part := templatePart{fn: &fn}
+	for i, kind := range fn.args {
+		word := words[i+1]
+		var arg templateArg
+		switch kind {
+		case "int":
+			if arg.int, err = strconv.Atoi(word); err != nil {
+				return part, fmt.Errorf("%s: invalid integer %s", words[0], word)
+			}
+		case "string":
+			if arg.str, err = strconv.Unquote(word); err != nil {
+				return part, fmt.Errorf("%s: invalid string %s", words[0], word)
+			}
+		}
+		part.args = append(part.args, arg)
+	}
+
+	// Check the arguments once, so the calls can't fail
+	switch words[0] {
+	case "randInt":
+		if part.args[0].int > part.args[1].int {
+			return part, fmt.Errorf("randInt: min %d is greater than max %d", part.args[0].int, part.args[1].int)
+		}
+	case "randString":
+		if part.args[0].int < 0 {
+			return part, fmt.Errorf("randString: negative length %d", part.args[0].int)
+		}
+	case "csv":
+		if len(set.dataRows) == 0 {
+			return part, fmt.Errorf("csv: no data file given")
+		}
+		if _, ok := set.dataColumns[part.args[0].str]; !ok {
+			return part, fmt.Errorf("csv: unknown column %q", part.args[0].str)
+		}
+	}
+	return part, nil
+}
+
+// splitTemplateAction splits an action on the spaces, outside of the quoted
+// strings
+func splitTemplateAction(action string) ([]string, error) {
+	var words []string
+	rest := strings.TrimSpace(action)
+	for rest != "" {
+		var word string
+		if rest[0] == '"' {
+			end := 1
+			for end < len(rest) && rest[end] != '"' {
+				if rest[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(rest) {
+				return nil, fmt.Errorf("unterminated string %s", rest)
+			}
+			word = rest[:end+1]
+		} else {
+			word, _, _ = strings.Cut(rest, " ")
+		}
+		words = append(words, word)
+		rest = strings.TrimSpace(rest[len(word):])
+	}
+	return words, nil
+}
+
+// loadDataFile loads a CSV file whose first row names the columns
+func (set *templateSet) loadDataFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) < 2 {
+		return fmt.Errorf("expected a header row and at least one row")
+	}
+	for i, name := range records[0] {
+		set.dataColumns[strings.TrimSpace(name)] = i
+	}
+	set.dataRows = records[1:]
+	return nil
+}
+
+// Expand returns the text with its templates evaluated for the request, or an
+// error if they are invalid. The texts of the URLs, headers and bodies of the
+// options are compiled once when the run is created, the other ones, only
+// known to the traffic types, are compiled each time they are expanded
+func (vars *RequestVars) Expand(text string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	set := vars.templates
+	if set == nil {
+		set = &templateSet{}
+	}
+	t, ok := set.templates[text]
+	if !ok {
+		var err error
+		if t, err = set.parseTemplate(text); err != nil {
+			return text, fmt.Errorf("template %q: %s", text, err)
+		}
+	}
+
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.fn == nil {
+			b.WriteString(part.text)
+			continue
+		}
+		b.WriteString(part.fn.call(vars, part.args))
+	}
+	return b.String(), nil
+}
+
+// expand returns the text of the options with its templates evaluated, they
+// are checked when the run is created so they can't fail
+func (vars *RequestVars) expand(text string) string {
+	s, _ := vars.Expand(text)
+	return s
+}
@@ -0,0 +1,123 @@
+package simulator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	opts := DefaultOptions()
+	opts.URLs = []URLEntry{{URL: "http://api.test/items/{{randInt 1 9}}", Weight: 1}}
+	trafficGen, err := NewTrafficGenerator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"http://api.test/items/{{randInt 1 9}}", `^http://api\.test/items/[1-9]$`},
+		// Only known to the traffic type, compiled when expanded
+		{"tcp://{{workerID}}-{{seq}}/{{randString 4}}", `^tcp://3-7/[a-zA-Z0-9]{4}$`},
+		{"{{uuid}}", `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{"plain text", `^plain text$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			vars := &RequestVars{templates: trafficGen.templates, worker: 3, seq: 7, seed: 1}
+			got, err := vars.Expand(tt.text)
+			if err != nil {
+				t.Fatalf("Expand(%q) error = %s", tt.text, err)
+			}
+			if !regexp.MustCompile(tt.want).MatchString(got) {
+				t.Errorf("Expand(%q) = %q, want it to match %s", tt.text, got, tt.want)
+			}
+		})
+	}
+
+	// The same seed gives the same values
+	a := &RequestVars{templates: trafficGen.templates, seed: 42}
+	b := &RequestVars{templates: trafficGen.templates, seed: 42}
+	x, _ := a.Expand("{{randString 16}}")
+	y, _ := b.Expand("{{randString 16}}")
+	if x != y {
+		t.Errorf("Expand() = %q and %q with the same seed, want the same value", x, y)
+	}
+
+	// Without the templates of a run, the functions still work
+	empty := RequestVars{seq: 5}
+	if got, err := empty.Expand("{{seq}}"); got != "5" || err != nil {
+		t.Errorf("Expand() without templates = %q, %v, want 5", got, err)
+	}
+}
+
+func TestExpandErrors(t *testing.T) {
+	trafficGen, err := NewTrafficGenerator(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled := len(trafficGen.templates.templates)
+	for _, text := range []string{"{{unknown}}", "{{randInt 1", `{{csv "id"}}`} {
+		vars := &RequestVars{templates: trafficGen.templates}
+		if _, err := vars.Expand(text); err == nil || !strings.Contains(err.Error(), fmt.Sprintf("%q", text)) {
+			t.Errorf("Expand(%q) error = %v, want it to name the template", text, err)
+		}
+	}
+	// The texts only known to the traffic types are not kept
+	for i := 0; i < 100; i++ {
+		vars := &RequestVars{templates: trafficGen.templates, seq: i}
+		vars.Expand(fmt.Sprintf("/items/%d/{{seq}}", i))
+	}
+	if got := len(trafficGen.templates.templates); got != compiled {
+		t.Errorf("%d compiled templates after the expansions, want %d", got, compiled)
+	}
+}
+
+func TestExpandConcurrently(t *testing.T) {
+	trafficGen, err := NewTrafficGenerator(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			vars := &RequestVars{templates: trafficGen.templates, seq: i}
+			if got, _ := vars.Expand("seq={{seq}}"); got != fmt.Sprintf("seq=%d", i) {
+				t.Errorf("Expand() = %q, want the sequence number", got)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestTemplateErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"{{randInt 1 10", "unclosed action"},
+		{"{{}}", "empty action"},
+		{"{{now}}", "unknown function"},
+		{"{{randInt 1}}", "expects 2 arguments"},
+		{"{{randInt a 2}}", "invalid integer"},
+		{"{{randInt 5 1}}", "greater than max"},
+		{"{{randString -1}}", "negative length"},
+		{`{{csv "id}}`, "unterminated string"},
+		{`{{csv "id"}}`, "no data file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Body = tt.source
+			_, err := NewTrafficGenerator(opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewTrafficGenerator() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
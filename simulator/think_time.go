@@ -0,0 +1,106 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Think-time distributions
+const (
+	// ConstantWait always waits the average wait
+	ConstantWait = "constant"
+	// UniformWait waits between min and max ms, 0 and twice the average by
+	// default
+	UniformWait = "uniform"
+	// ExponentialWait waits the average wait on average, like Poisson
+	// arrivals
+	ExponentialWait = "exponential"
+	// NormalWait waits the average wait on average, with a standard
+	// deviation in ms of a quarter of the average by default
+	NormalWait = "normal"
+	// LogNormalWait waits the average wait on average, with a sigma of 0.5
+	// by default
+	LogNormalWait = "lognormal"
+)
+
+// ThinkTime represents the distribution of the time waited between two
+// requests
+type ThinkTime struct {
+	distribution string
+	params       []float64
+	// avg is the average time to wait
+	avg time.Duration
+}
+
+// ParseThinkTime parses a distribution written as "name" or
+// "name:param1,param2", around the given average
+func ParseThinkTime(spec string, avg time.Duration) (*ThinkTime, error) {
+	name, rawParams, _ := strings.Cut(spec, ":")
+	t := &ThinkTime{distribution: name, avg: avg}
+	if rawParams != "" {
+		for _, raw := range strings.Split(rawParams, ",") {
+			p, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+			if err != nil || p < 0 {
+				return nil, fmt.Errorf("invalid parameter %q for the %s distribution", raw, name)
+			}
+			t.params = append(t.params, p)
+		}
+	}
+
+	var nbOfParams int
+	switch name {
+	case ConstantWait, ExponentialWait:
+	case UniformWait:
+		nbOfParams = 2
+		if len(t.params) == 2 && t.params[0] > t.params[1] {
+			return nil, fmt.Errorf("the min of the %s distribution is greater than its max", name)
+		}
+	case NormalWait, LogNormalWait:
+		nbOfParams = 1
+	default:
+		return nil, fmt.Errorf("unknown distribution %q", name)
+	}
+	if len(t.params) != 0 && len(t.params) != nbOfParams {
+		return nil, fmt.Errorf("the %s distribution expects %d parameters, got %d", name, nbOfParams, len(t.params))
+	}
+	return t, nil
+}
+
+// next returns the time to wait before the next request
+func (t *ThinkTime) next(rng *rand.Rand) time.Duration {
+	avg := float64(t.avg) / float64(time.Millisecond)
+
+	var ms float64
+	switch t.distribution {
+	case UniformWait:
+		min, max := 0.0, 2*avg
+		if len(t.params) == 2 {
+			min, max = t.params[0], t.params[1]
+		}
+		ms = min + rng.Float64()*(max-min)
+	case ExponentialWait:
+		ms = rng.ExpFloat64() * avg
+	case NormalWait:
+		stddev := avg / 4
+		if len(t.params) == 1 {
+			stddev = t.params[0]
+		}
+		ms = math.Max(0, avg+rng.NormFloat64()*stddev)
+	case LogNormalWait:
+		sigma := 0.5
+		if len(t.params) == 1 {
+			sigma = t.params[0]
+		}
+		if avg > 0 {
+			mu := math.Log(avg) - sigma*sigma/2
+			ms = math.Exp(mu + rng.NormFloat64()*sigma)
+		}
+	default:
+		ms = avg
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
@@ -0,0 +1,108 @@
+package simulator
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseThinkTime(t *testing.T) {
+	tests := []struct {
+		spec   string
+		name   string
+		params []float64
+	}{
+		{"constant", ConstantWait, nil},
+		{"exponential", ExponentialWait, nil},
+		{"uniform", UniformWait, nil},
+		{"uniform:50,150", UniformWait, []float64{50, 150}},
+		{"uniform: 0, 10", UniformWait, []float64{0, 10}},
+		{"normal", NormalWait, nil},
+		{"normal:20", NormalWait, []float64{20}},
+		{"lognormal:1.5", LogNormalWait, []float64{1.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseThinkTime(tt.spec, time.Second)
+			if err != nil {
+				t.Fatalf("ParseThinkTime() error = %s", err)
+			}
+			if got.distribution != tt.name || !reflect.DeepEqual(got.params, tt.params) || got.avg != time.Second {
+				t.Errorf("ParseThinkTime() = %s %v around %s, want %s %v around 1s", got.distribution, got.params, got.avg, tt.name, tt.params)
+			}
+		})
+	}
+}
+
+func TestParseThinkTimeErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"poisson", `unknown distribution "poisson"`},
+		{"", `unknown distribution ""`},
+		{"uniform:10", "the uniform distribution expects 2 parameters, got 1"},
+		{"uniform:150,50", "the min of the uniform distribution is greater than its max"},
+		{"normal:1,2", "the normal distribution expects 1 parameters, got 2"},
+		{"constant:5", "the constant distribution expects 0 parameters, got 1"},
+		{"normal:abc", `invalid parameter "abc" for the normal distribution`},
+		{"lognormal:-1", `invalid parameter "-1" for the lognormal distribution`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := ParseThinkTime(tt.spec, time.Second)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseThinkTime() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestThinkTimeNext(t *testing.T) {
+	tests := []struct {
+		spec     string
+		min, max time.Duration
+		// mean and stddev are the expected moments of the samples, stddev is
+		// not checked if zero
+		mean, stddev time.Duration
+	}{
+		{"constant", 100 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond, 0},
+		{"uniform", 0, 200 * time.Millisecond, 100 * time.Millisecond, 57735 * time.Microsecond},
+		{"uniform:50,70", 50 * time.Millisecond, 70 * time.Millisecond, 60 * time.Millisecond, 5774 * time.Microsecond},
+		{"exponential", 0, time.Hour, 100 * time.Millisecond, 100 * time.Millisecond},
+		{"normal", 0, time.Hour, 100 * time.Millisecond, 25 * time.Millisecond},
+		{"normal:10", 0, time.Hour, 100 * time.Millisecond, 10 * time.Millisecond},
+		{"lognormal", 0, time.Hour, 100 * time.Millisecond, 53294 * time.Microsecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			thinkTime, err := ParseThinkTime(tt.spec, 100*time.Millisecond)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rng := rand.New(rand.NewSource(1))
+			const n = 100000
+			var sum, sumSquares float64
+			for i := 0; i < n; i++ {
+				d := thinkTime.next(rng)
+				if d < tt.min || d > tt.max {
+					t.Fatalf("next() = %s, want it between %s and %s", d, tt.min, tt.max)
+				}
+				sum += float64(d)
+				sumSquares += float64(d) * float64(d)
+			}
+
+			mean := sum / n
+			stddev := math.Sqrt(sumSquares/n - mean*mean)
+			if math.Abs(mean-float64(tt.mean)) > 0.02*float64(tt.mean) {
+				t.Errorf("mean = %s, want %s", time.Duration(mean), tt.mean)
+			}
+			if tt.stddev != 0 && math.Abs(stddev-float64(tt.stddev)) > 0.03*float64(tt.stddev) {
+				t.Errorf("stddev = %s, want %s", time.Duration(stddev), tt.stddev)
+			}
+		})
+	}
+}
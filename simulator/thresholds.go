@@ -0,0 +1,291 @@
+package simulator
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// abortCheckInterval is the interval at which the abort thresholds are
+// checked during the run
+const abortCheckInterval = time.Second
+
+// Kinds of the metrics of the thresholds
+const (
+	countMetric = iota
+	rateMetric
+	durationMetric
+)
+
+// thresholdRegexp matches a threshold like "p99<300ms"
+var thresholdRegexp = regexp.MustCompile(`^\s*([\w.]+)\s*(<=|>=|==|!=|<|>)\s*(\S+)\s*$`)
+
+// Threshold represents a condition the stats of a run must meet
+type Threshold struct {
+	expr   string
+	metric string
+	op     string
+	limit  float64
+	// Abort is true if the run is stopped as soon as the threshold fails
+	Abort bool
+}
+
+// String returns the threshold as written
+func (t *Threshold) String() string {
+	return t.expr
+}
+
+// ThresholdResult represents the verdict of a threshold
+type ThresholdResult struct {
+	Threshold string `json:"threshold"`
+	Value     string `json:"value"`
+	Passed    bool   `json:"passed"`
+	Aborted   bool   `json:"aborted"`
+}
+
+// metricKind returns the kind of a metric, or an error if it is unknown
+func metricKind(metric string) (int, error) {
+	switch {
+	case metric == "requests", metric == "rps", strings.HasPrefix(metric, "status_") && len(metric) > len("status_"):
+		return countMetric, nil
+	case metric == "error_rate", strings.HasSuffix(metric, "_rate") && criticityByName(strings.TrimSuffix(metric, "_rate")):
+		return rateMetric, nil
+	case metric == "min", metric == "max", metric == "avg":
+		return durationMetric, nil
+	}
+	for _, name := range percentileHeaders() {
+		if metric == name {
+			return durationMetric, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown metric %q, expected requests, rps, error_rate, success_rate, warning_rate, critical_rate, failed_rate, interrupted_rate, min, max, avg, %s or status_<code|class|name>", metric, strings.Join(percentileHeaders(), ", "))
+}
+
+// criticityByName returns true if a criticity level has the name
+func criticityByName(name string) bool {
+	for _, n := range criticityName {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseThreshold parses a threshold written as "metric<op>value" like
+// "error_rate<1%", "p99<300ms", "rps>500" or "status_5xx==0"
+func ParseThreshold(expr string) (*Threshold, error) {
+	m := thresholdRegexp.FindStringSubmatch(expr)
+	if m == nil {
+		return nil, fmt.Errorf("invalid threshold %q, expected metric<op>value like p99<300ms", expr)
+	}
+	t := &Threshold{expr: strings.TrimSpace(expr), metric: m[1], op: m[2]}
+	kind, err := metricKind(t.metric)
+	if err != nil {
+		return nil, fmt.Errorf("threshold %q: %s", expr, err)
+	}
+
+	raw := m[3]
+	switch {
+	case kind == rateMetric && strings.HasSuffix(raw, "%"):
+		t.limit, err = strconv.ParseFloat(strings.TrimSuffix(raw, "%"), 64)
+		t.limit /= 100
+	case kind == durationMetric:
+		var d time.Duration
+		d, err = time.ParseDuration(raw)
+		t.limit = float64(d)
+	default:
+		t.limit, err = strconv.ParseFloat(raw, 64)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("threshold %q: invalid value %q", expr, raw)
+	}
+	return t, nil
+}
+
+// value returns the value of the metric of the threshold in the summary of a
+// run which lasted the given time, the rates are shares of all the requests,
+// the interrupted ones included
+func (t *Threshold) value(s *Summary, elapsed time.Duration) float64 {
+	total := s.Requests + s.Interrupted
+	switch t.metric {
+	case "requests":
+		return float64(s.Requests)
+	case "rps":
+		if elapsed <= 0 {
+			return 0
+		}
+		return float64(s.Requests) / elapsed.Seconds()
+	case "error_rate":
+		return rateOf(s.Errors, total)
+	case "min":
+		return float64(s.MinDuration)
+	case "max":
+		return float64(s.MaxDuration)
+	case "avg":
+		return float64(s.AvgDuration)
+	}
+	if name, ok := strings.CutSuffix(t.metric, "_rate"); ok {
+		return rateOf(s.Criticities[name], total)
+	}
+	if status, ok := strings.CutPrefix(t.metric, "status_"); ok {
+		return float64(statusCount(s, status))
+	}
+	return float64(s.Percentiles[t.metric])
+}
+
+// rateOf returns the ratio of n over the total, 0 if there is none
+func rateOf(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// statusCount returns the number of responses with a status code like "404",
+// a class of status codes like "5xx", or a status like "NXDOMAIN"
+func statusCount(s *Summary, status string) int {
+	if len(status) == 3 && strings.HasSuffix(strings.ToLower(status), "xx") {
+		var count int
+		for code, n := range s.StatusCodes {
+			if code[0] == status[0] {
+				count += n
+			}
+		}
+		return count
+	}
+	if n, ok := s.StatusCodes[status]; ok {
+		return n
+	}
+	return s.Statuses[status]
+}
+
+// passes returns true if the value meets the threshold
+func (t *Threshold) passes(v float64) bool {
+	switch t.op {
+	case "<":
+		return v < t.limit
+	case "<=":
+		return v <= t.limit
+	case ">":
+		return v > t.limit
+	case ">=":
+		return v >= t.limit
+	case "==":
+		return v == t.limit
+	default:
+		return v != t.limit
+	}
+}
+
+// format returns the value of the metric as written in the verdict
+func (t *Threshold) format(v float64) string {
+	kind, _ := metricKind(t.metric)
+	switch {
+	case kind == rateMetric:
+		return fmt.Sprintf("%.2f%%", v*100)
+	case kind == durationMetric:
+		return time.Duration(v).String()
+	case t.metric == "rps":
+		return fmt.Sprintf("%.1f", v)
+	default:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+}
+
+// hasAbortThresholds returns true if a threshold can abort the run
+func (trafficGen *TrafficGenerator) hasAbortThresholds() bool {
+	for _, t := range trafficGen.opts.Thresholds {
+		if t.Abort {
+			return true
+		}
+	}
+	return false
+}
+
+// Aborted returns true if the run was aborted by a threshold
+func (trafficGen *TrafficGenerator) Aborted() bool {
+	return trafficGen.aborted != nil
+}
+
+// watchThresholds checks the abort thresholds until the run is over, after a
+// grace period for the stats to settle, and stops the run if one fails
+func (trafficGen *TrafficGenerator) watchThresholds(grace time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(abortCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-trafficGen.over:
+			return
+		case now := <-ticker.C:
+			elapsed := now.Sub(trafficGen.start)
+			if elapsed < grace {
+				continue
+			}
+			summary := trafficGen.Summary()
+			for _, t := range trafficGen.opts.Thresholds {
+				if !t.Abort {
+					continue
+				}
+				if v := t.value(summary, elapsed); !t.passes(v) {
+					trafficGen.aborted = t
+					trafficGen.stop(fmt.Sprintf("Threshold %s failed with %s, aborting the run", t.expr, t.format(v)))
+					return
+				}
+			}
+		}
+	}
+}
+
+// CheckThresholds renders the verdict of the thresholds against the final
+// stats, and returns true if they all passed
+func (trafficGen *TrafficGenerator) CheckThresholds() bool {
+	if len(trafficGen.opts.Thresholds) == 0 {
+		return true
+	}
+	summary := trafficGen.Summary()
+	out := trafficGen.opts.output()
+
+	table := tablewriter.NewWriter(out)
+	table.SetAlignment(tablewriter.ALIGN_CENTER)
+	table.SetHeader([]string{"Threshold", "Value", "Verdict"})
+	passed := true
+	trafficGen.results = nil
+	for _, t := range trafficGen.opts.Thresholds {
+		v := t.value(summary, summary.ExecDuration)
+		result := ThresholdResult{
+			Threshold: t.expr,
+			Value:     t.format(v),
+			Passed:    t.passes(v),
+			Aborted:   t == trafficGen.aborted,
+		}
+		// The threshold which aborted the run fails, even if the final stats
+		// meet it
+		if result.Aborted {
+			result.Passed = false
+		}
+		trafficGen.results = append(trafficGen.results, result)
+
+		verdict := green("PASS")
+		if !result.Passed {
+			passed = false
+			verdict = red("FAIL")
+			if result.Aborted {
+				verdict = red("FAIL (aborted)")
+			}
+		}
+		table.Append([]string{t.expr, result.Value, verdict})
+	}
+
+	fmt.Fprintf(out, "\nThresholds :\n")
+	table.Render()
+	if !passed {
+		trafficGen.logger.Printf("Thresholds failed")
+	}
+	return passed
+}
@@ -0,0 +1,224 @@
+package simulator
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseThreshold(t *testing.T) {
+	tests := []struct {
+		expr   string
+		metric string
+		op     string
+		limit  float64
+	}{
+		{"p99<300ms", "p99", "<", float64(300 * time.Millisecond)},
+		{" p99.9 <= 1s ", "p99.9", "<=", float64(time.Second)},
+		{"error_rate<1%", "error_rate", "<", 0.01},
+		{"error_rate<0.01", "error_rate", "<", 0.01},
+		{"success_rate>=99.5%", "success_rate", ">=", 0.995},
+		{"rps>500", "rps", ">", 500},
+		{"requests!=0", "requests", "!=", 0},
+		{"status_5xx==0", "status_5xx", "==", 0},
+		{"status_NXDOMAIN==0", "status_NXDOMAIN", "==", 0},
+		{"avg<50ms", "avg", "<", float64(50 * time.Millisecond)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			th, err := ParseThreshold(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseThreshold() error = %s", err)
+			}
+			if th.metric != tt.metric || th.op != tt.op || th.limit != tt.limit {
+				t.Errorf("ParseThreshold() = %s %s %v, want %s %s %v", th.metric, th.op, th.limit, tt.metric, tt.op, tt.limit)
+			}
+			if th.String() != strings.TrimSpace(tt.expr) {
+				t.Errorf("String() = %q, want %q", th.String(), strings.TrimSpace(tt.expr))
+			}
+		})
+	}
+}
+
+func TestParseThresholdErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"p99", "expected metric<op>value"},
+		{"p99=<300ms", "expected metric<op>value"},
+		{"p42<300ms", "unknown metric"},
+		{"status_<1", "unknown metric"},
+		{"unknown_rate<1%", "unknown metric"},
+		{"p99<300", "invalid value"},
+		{"rps>5%", "invalid value"},
+		{"error_rate<one%", "invalid value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseThreshold(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseThreshold() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestThresholdValue(t *testing.T) {
+	s := &Summary{
+		Requests:    200,
+		Errors:      10,
+		MinDuration: time.Millisecond,
+		MaxDuration: time.Second,
+		AvgDuration: 20 * time.Millisecond,
+		Percentiles: map[string]time.Duration{"p99": 300 * time.Millisecond},
+		Statuses:    map[string]int{"200 OK": 180, "404 Not Found": 10, "503 Service Unavailable": 6, "NXDOMAIN": 4},
+		StatusCodes: map[string]int{"200": 180, "404": 10, "503": 6},
+		Criticities: map[string]int{"success": 180, "warning": 10, "critical": 6, "failed": 4},
+	}
+	tests := []struct {
+		expr   string
+		value  string
+		passes bool
+	}{
+		{"requests==200", "200", true},
+		{"rps>=20", "20.0", true},
+		{"error_rate<=5%", "5.00%", true},
+		{"warning_rate<5%", "5.00%", false},
+		{"success_rate>90%", "90.00%", false},
+		{"status_5xx==0", "6", false},
+		{"status_404<20", "10", true},
+		{"status_NXDOMAIN==4", "4", true},
+		{"p99<300ms", "300ms", false},
+		{"min>=1ms", "1ms", true},
+		{"max<1s", "1s", false},
+		{"avg!=0s", "20ms", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			th, err := ParseThreshold(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v := th.value(s, 10*time.Second)
+			if got := th.format(v); got != tt.value {
+				t.Errorf("value = %s, want %s", got, tt.value)
+			}
+			if got := th.passes(v); got != tt.passes {
+				t.Errorf("passes(%s) = %v, want %v", th.format(v), got, tt.passes)
+			}
+		})
+	}
+}
+
+func TestAbortThreshold(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	th, err := ParseThreshold("status_5xx==0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	th.Abort = true
+	opts := DefaultOptions()
+	opts.Clients = 2
+	opts.Duration = time.Minute
+	opts.Wait = 10 * time.Millisecond
+	opts.AbortAfter = 0
+	opts.Thresholds = []*Threshold{th}
+	opts.URLs = []URLEntry{{URL: ts.URL, Weight: 1}}
+	opts.Output = io.Discard
+	trafficGen, err := NewTrafficGenerator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	trafficGen.Generate(context.Background())
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("the run lasted %s, want it aborted", elapsed)
+	}
+	if !trafficGen.Aborted() {
+		t.Errorf("Aborted() = false, want the run aborted by %s", th)
+	}
+}
+
+func TestInterruptedRateThreshold(t *testing.T) {
+	// The requests hang until the test is over, to be aborted by the drain
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	th, err := ParseThreshold("interrupted_rate==0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	opts.Clients = 3
+	opts.Requests = 0
+	opts.Duration = 100 * time.Millisecond
+	opts.Drain = 50 * time.Millisecond
+	opts.Timeout = time.Minute
+	opts.Thresholds = []*Threshold{th}
+	opts.URLs = []URLEntry{{URL: ts.URL, Weight: 1}}
+	opts.Output = io.Discard
+	trafficGen, err := NewTrafficGenerator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trafficGen.Generate(context.Background())
+
+	if s := trafficGen.Summary(); s.Interrupted != 3 || s.Requests != 0 {
+		t.Fatalf("Summary() = %d requests and %d interrupted, want 3 interrupted", s.Requests, s.Interrupted)
+	}
+	if trafficGen.CheckThresholds() {
+		t.Errorf("CheckThresholds() = true, want %s to fail", th)
+	}
+	if r := trafficGen.results[0]; r.Passed || r.Value != "100.00%" {
+		t.Errorf("result = %+v, want %s to fail with 100.00%%", r, th)
+	}
+}
+
+func TestErrorRateOfServerErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	th, err := ParseThreshold("error_rate<1%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	opts.Clients = 2
+	opts.Requests = 3
+	opts.Wait = 0
+	opts.Thresholds = []*Threshold{th}
+	opts.URLs = []URLEntry{{URL: ts.URL, Weight: 1}}
+	opts.Output = io.Discard
+	trafficGen, err := NewTrafficGenerator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trafficGen.Generate(context.Background())
+
+	// The 500 responses are warnings, but they are errors
+	if s := trafficGen.Summary(); s.Criticities["warning"] != 6 || s.Errors != 6 {
+		t.Errorf("Summary() = %d warnings and %d errors, want 6 of each", s.Criticities["warning"], s.Errors)
+	}
+	if trafficGen.CheckThresholds() {
+		t.Errorf("CheckThresholds() = true, want %s to fail", th)
+	}
+}
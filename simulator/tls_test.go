@@ -0,0 +1,198 @@
+package simulator
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeCertificate writes the certificate and its key as PEM files in a
+// temporary directory, and returns their paths
+func writeCertificate(t *testing.T, cert tls.Certificate) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, testCertificate(t))
+
+	tests := []struct {
+		name  string
+		opts  TLSOptions
+		check func(*tls.Config) bool
+	}{
+		{"defaults", TLSOptions{}, func(c *tls.Config) bool {
+			return c.RootCAs == nil && len(c.Certificates) == 0 && c.MinVersion == 0 && c.MaxVersion == 0 && !c.InsecureSkipVerify
+		}},
+		{"insecure", TLSOptions{Insecure: true, ServerName: "example.com"}, func(c *tls.Config) bool {
+			return c.InsecureSkipVerify && c.ServerName == "example.com"
+		}},
+		{"CA file", TLSOptions{CAFile: certFile}, func(c *tls.Config) bool {
+			return c.RootCAs != nil
+		}},
+		{"client certificate", TLSOptions{CertFile: certFile, KeyFile: keyFile}, func(c *tls.Config) bool {
+			return len(c.Certificates) == 1
+		}},
+		{"versions", TLSOptions{MinVersion: "1.2", MaxVersion: "1.3"}, func(c *tls.Config) bool {
+			return c.MinVersion == tls.VersionTLS12 && c.MaxVersion == tls.VersionTLS13
+		}},
+		{"same versions", TLSOptions{MinVersion: "1.3", MaxVersion: "1.3"}, func(c *tls.Config) bool {
+			return c.MinVersion == tls.VersionTLS13 && c.MaxVersion == tls.VersionTLS13
+		}},
+		{"min version only", TLSOptions{MinVersion: "1.3"}, func(c *tls.Config) bool {
+			return c.MinVersion == tls.VersionTLS13 && c.MaxVersion == 0
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := newTLSConfig(tt.opts)
+			if err != nil {
+				t.Fatalf("newTLSConfig() error = %s", err)
+			}
+			if !tt.check(config) {
+				t.Errorf("newTLSConfig() = %+v, want the %s options applied", config, tt.name)
+			}
+		})
+	}
+}
+
+func TestNewTLSConfigErrors(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, testCertificate(t))
+	otherCertFile, _ := writeCertificate(t, testCertificate(t))
+	notPEM := filepath.Join(t.TempDir(), "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts TLSOptions
+		want string
+	}{
+		{"missing CA file", TLSOptions{CAFile: "/nonexistent/ca.pem"}, "no such file"},
+		{"CA file without certificate", TLSOptions{CAFile: notPEM}, "no certificate found in"},
+		{"certificate without key", TLSOptions{CertFile: certFile}, "must be given together"},
+		{"key without certificate", TLSOptions{KeyFile: keyFile}, "must be given together"},
+		{"mismatched key", TLSOptions{CertFile: otherCertFile, KeyFile: keyFile}, "private key does not match public key"},
+		{"unknown min version", TLSOptions{MinVersion: "1.4"}, `unknown TLS version "1.4"`},
+		{"unknown max version", TLSOptions{MaxVersion: "TLS1.2"}, `unknown TLS version "TLS1.2"`},
+		{"min over max", TLSOptions{MinVersion: "1.3", MaxVersion: "1.2"}, "the min version 1.3 is greater than the max version 1.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTLSConfig(tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("newTLSConfig() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// tlsRequest makes a request to the server with the TLS options, and returns
+// the version negotiated or the error
+func tlsRequest(t *testing.T, url string, o TLSOptions) (string, string) {
+	t.Helper()
+	opts := DefaultOptions()
+	opts.Clients = 1
+	opts.Requests = 1
+	opts.TLS = o
+	opts.Output = io.Discard
+	trafficGen, err := NewTrafficGenerator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := &URLEntry{URL: url, Weight: 1}
+	vars := &RequestVars{templates: trafficGen.templates}
+	r := getURL(context.Background(), entry, trafficGen.NewWorker(1), vars).(*HTTPRequest)
+	if r.err != nil {
+		return "", r.err.Error()
+	}
+	return r.tls.Version, ""
+}
+
+func TestTLSRequests(t *testing.T) {
+	clientCert := testCertificate(t)
+	clientCertFile, clientKeyFile := writeCertificate(t, clientCert)
+	clientCAs := x509.NewCertPool()
+	leaf, err := x509.ParseCertificate(clientCert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs.AddCert(leaf)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	ts.TLS = &tls.Config{
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  clientCAs,
+		MaxVersion: tls.VersionTLS12,
+	}
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The mTLS server requires a client certificate, and accepts TLS 1.3
+	mtls := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	mtls.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	mtls.Config.ErrorLog = log.New(io.Discard, "", 0)
+	mtls.StartTLS()
+	defer mtls.Close()
+	mtlsCAFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(mtlsCAFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: mtls.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		url         string
+		opts        TLSOptions
+		wantVersion string
+		wantErr     string
+	}{
+		{"untrusted", ts.URL, TLSOptions{}, "", "certificate"},
+		{"CA file", ts.URL, TLSOptions{CAFile: caFile}, "TLS 1.2", ""},
+		{"insecure", ts.URL, TLSOptions{Insecure: true}, "TLS 1.2", ""},
+		{"max version", mtls.URL, TLSOptions{CAFile: mtlsCAFile, CertFile: clientCertFile, KeyFile: clientKeyFile, MaxVersion: "1.2"}, "TLS 1.2", ""},
+		{"min version", ts.URL, TLSOptions{CAFile: caFile, MinVersion: "1.3"}, "", "protocol version"},
+		{"mTLS", mtls.URL, TLSOptions{CAFile: mtlsCAFile, CertFile: clientCertFile, KeyFile: clientKeyFile}, "TLS 1.3", ""},
+		{"mTLS without certificate", mtls.URL, TLSOptions{CAFile: mtlsCAFile}, "", "certificate required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, err := tlsRequest(t, tt.url, tt.opts)
+			if tt.wantErr != "" {
+				if !strings.Contains(err, tt.wantErr) {
+					t.Errorf("request error = %q, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != "" || version != tt.wantVersion {
+				t.Errorf("request = %q, %q, want %q", version, err, tt.wantVersion)
+			}
+		})
+	}
+}
@@ -0,0 +1,639 @@
+package simulator
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// TrafficGenerator represents the traffic generation object
+type TrafficGenerator struct {
+	opts        Options
+	stats       Stats
+	trafficType TrafficType
+	wg          sync.WaitGroup
+	// over is closed when the duration of the run is reached or when the
+	// run is aborted
+	over     chan struct{}
+	eventLog *EventLog
+	metrics  *Metrics
+	progress *Progress
+	stages   *StageStats
+	// start is the time at which the generation started
+	start time.Time
+	// logger writes the messages of the run to the output of the options
+	logger *log.Logger
+	// stopOnce closes over only once, whether the duration is reached or
+	// the run is aborted
+	stopOnce sync.Once
+	// aborted is the threshold which aborted the run, if any
+	aborted *Threshold
+	results []ThresholdResult
+	// interrupted is the number of requests aborted at the end of the drain
+	// period
+	interrupted atomic.Int64
+	// urls are the URLs to test, and cumulativeWeights their cumulative
+	// weights, used to pick them randomly according to their weights
+	urls              []URLEntry
+	cumulativeWeights []float64
+	thinkTime         *ThinkTime
+	profile           *Profile
+	templates         *templateSet
+	tlsConfig         *tls.Config
+	// clientsChanged is closed and replaced each time the number of clients
+	// of the profile changes, to wake up the idle workers
+	clientsChanged   chan struct{}
+	clientsChangedMu sync.Mutex
+	// sharedClient holds the connections shared between the workers
+	sharedClient     *http.Client
+	sharedClientOnce sync.Once
+	// lastConnID is the id of the last connection opened
+	lastConnID atomic.Uint64
+	// activeStreams counts the requests in flight on each connection
+	activeStreams   map[uint64]int
+	activeStreamsMu sync.Mutex
+}
+
+// Worker represents a client making the requests
+type Worker struct {
+	id         int
+	trafficGen *TrafficGenerator
+	// rng is owned by the worker, so its random choices only depend on the
+	// seed and not on the scheduling of the go routines
+	rng *rand.Rand
+	// client holds the connections of the worker, in the worker connection
+	// mode
+	client     *http.Client
+	clientOnce sync.Once
+}
+
+// NewTrafficGenerator will return a new TrafficGenerator object, making the
+// requests described by the options
+func NewTrafficGenerator(opts Options) (*TrafficGenerator, error) {
+	if opts.Type == "" {
+		opts.Type = HTTPTraffic
+	}
+	trafficType, ok := lookupTrafficType(opts.Type)
+	if !ok {
+		return nil, ErrInvalidTrafficType
+	}
+	thinkTime, profile, err := opts.normalize(trafficType)
+	if err != nil {
+		return nil, err
+	}
+
+	trafficGen := &TrafficGenerator{
+		opts:           opts,
+		trafficType:    trafficType,
+		over:           make(chan struct{}),
+		thinkTime:      thinkTime,
+		profile:        profile,
+		clientsChanged: make(chan struct{}),
+		activeStreams:  map[uint64]int{},
+	}
+	trafficGen.logger = log.New(trafficGen.opts.output(), "", 0)
+	trafficGen.stats = trafficType.NewStats(&trafficGen.opts)
+	if profile != nil {
+		trafficGen.stages = newStageStats(profile)
+	}
+	if trafficGen.tlsConfig, err = newTLSConfig(opts.TLS); err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration: %s", err)
+	}
+	if trafficGen.templates, err = newTemplateSet(&trafficGen.opts); err != nil {
+		return nil, err
+	}
+	trafficGen.setURLs(opts.URLs)
+	return trafficGen, nil
+}
+
+// Options returns the options of the run, with their defaults filled
+func (trafficGen *TrafficGenerator) Options() Options {
+	return trafficGen.opts
+}
+
+// Generate generates traffic until the requests are made, the duration is
+// reached or the context is canceled, the requests in flight are then given
+// the drain period to finish before being aborted
+func (trafficGen *TrafficGenerator) Generate(ctx context.Context) {
+	start := time.Now()
+	trafficGen.start = start
+
+	// The requests have their own context, canceled once the drain period
+	// is elapsed
+	reqCtx, abort := context.WithCancel(context.Background())
+	defer abort()
+	go trafficGen.drain(ctx, reqCtx, abort)
+	// Report the progress periodically, until the run returns
+	if trafficGen.opts.Interval > 0 {
+		trafficGen.progress = newProgress(trafficGen.logger)
+		stopProgress := make(chan struct{})
+		reporting := make(chan struct{})
+		defer func() {
+			close(stopProgress)
+			<-reporting
+		}()
+		go func() {
+			defer close(reporting)
+			trafficGen.progress.reportEvery(trafficGen.opts.Interval, stopProgress)
+		}()
+	}
+
+	// Stop making new requests once the duration is reached
+	if trafficGen.opts.Duration > 0 {
+		timer := time.AfterFunc(trafficGen.opts.Duration, func() {
+			trafficGen.stop("Duration reached, waiting for the requests in flight")
+		})
+		defer timer.Stop()
+	}
+
+	// Abort the run as soon as an abort threshold fails, the watcher is
+	// waited for before leaving as it records the failed threshold
+	if trafficGen.hasAbortThresholds() {
+		stopWatching := make(chan struct{})
+		watching := make(chan struct{})
+		defer func() {
+			close(stopWatching)
+			<-watching
+		}()
+		go func() {
+			defer close(watching)
+			trafficGen.watchThresholds(trafficGen.opts.AbortAfter, stopWatching)
+		}()
+	}
+
+	// Wake up the idle workers when the clients profile needs them
+	if trafficGen.profile != nil && trafficGen.opts.Rate == 0 {
+		stopWatching := make(chan struct{})
+		watching := make(chan struct{})
+		defer func() {
+			close(stopWatching)
+			<-watching
+		}()
+		go func() {
+			defer close(watching)
+			trafficGen.watchClients(stopWatching)
+		}()
+	}
+
+	// In rate mode a single dispatcher sends the requests on a fixed
+	// schedule, otherwise each client is a worker
+	if trafficGen.opts.Rate > 0 {
+		trafficGen.wg.Add(1)
+		go trafficGen.dispatch(reqCtx)
+	} else {
+		for i := 1; i <= trafficGen.opts.Clients; i++ {
+			trafficGen.wg.Add(1)
+			// Launch the workers in a go routine
+			go trafficGen.NewWorker(i).work(reqCtx)
+		}
+	}
+
+	// Wait for the workers, they stop once the run is over
+	trafficGen.wg.Wait()
+	// Close the connections shared between the workers, the ones of each
+	// worker are closed when it is done
+	if trafficGen.sharedClient != nil {
+		trafficGen.sharedClient.CloseIdleConnections()
+	}
+	// All the workers are done, record the real duration
+	trafficGen.stats.SetDuration(time.Since(start))
+}
+
+// drain stops the run when the given context is canceled, and aborts the
+// requests in flight once the drain period is elapsed after the run is over
+func (trafficGen *TrafficGenerator) drain(ctx, reqCtx context.Context, abort context.CancelFunc) {
+	select {
+	case <-ctx.Done():
+		trafficGen.stop("Interrupted, waiting for the requests in flight")
+	case <-trafficGen.over:
+	case <-reqCtx.Done():
+		return
+	}
+
+	timer := time.NewTimer(trafficGen.opts.Drain)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		trafficGen.logger.Println("Drain period elapsed, aborting the requests in flight")
+		abort()
+	case <-reqCtx.Done():
+	}
+}
+
+// NewWorker creates a new worker for traffic generation
+func (trafficGen *TrafficGenerator) NewWorker(i int) *Worker {
+	return &Worker{
+		id:         i,
+		trafficGen: trafficGen,
+		rng:        newWorkerRand(trafficGen.opts.Seed, i),
+	}
+}
+
+// Options returns the options of the run of the worker
+func (w *Worker) Options() *Options {
+	return &w.trafficGen.opts
+}
+
+// ID returns the id of the worker, starting at 1, or 0 for the dispatcher of
+// the rate mode
+func (w *Worker) ID() int {
+	return w.id
+}
+
+// TLSConfig returns the TLS configuration of the requests of the run
+func (w *Worker) TLSConfig() *tls.Config {
+	return w.trafficGen.tlsConfig
+}
+
+// DisplayStats renders the statistics of the traffic generation
+func (trafficGen *TrafficGenerator) DisplayStats() {
+	out := trafficGen.opts.output()
+	trafficGen.stats.Render()
+	if trafficGen.stages != nil {
+		trafficGen.stages.Render(out)
+	}
+	if n := trafficGen.interrupted.Load(); n > 0 {
+		table := tablewriter.NewWriter(out)
+		table.SetAlignment(tablewriter.ALIGN_CENTER)
+		table.SetHeader([]string{"Interrupted requests", "Drain period"})
+		table.Append([]string{strconv.FormatInt(n, 10), trafficGen.opts.Drain.String()})
+
+		fmt.Fprintf(out, "\nInterrupted :\n")
+		table.Render()
+	}
+}
+
+func (w *Worker) work(ctx context.Context) {
+	trafficGen := w.trafficGen
+	opts := w.Options()
+	defer trafficGen.wg.Done()
+	defer trafficGen.trackWorker()()
+	defer w.closeIdleConnections()
+
+	workerFmt := fmt.Sprintf("worker#%%0%dd", getPadding(opts.Clients))
+
+	prefix := fmt.Sprintf(workerFmt, w.id)
+	logger := trafficGen.newLogger(prefix)
+
+	// Repeat the requests, or until the duration is reached
+	for i := 1; opts.Duration > 0 || i <= opts.Requests; i++ {
+		// Wait while the worker is not needed by the current stage
+		w.waitActive(ctx)
+		// If the context is canceled or the run is over, quit
+		if ctx.Err() != nil || trafficGen.isOver() {
+			return
+		}
+		logger.SetPrefix(prefix + trafficGen.getCounter(i))
+		// Find an URL
+		url := trafficGen.findRandomURL(w.rng)
+		_, stage := trafficGen.profileAt(time.Now())
+		// Make the request, its templates use the random of the worker
+		vars := &RequestVars{templates: trafficGen.templates, worker: w.id, seq: i, rng: w.rng}
+		r := trafficGen.makeRequest(ctx, url, w, vars)
+		// Add the request to the stats and the sinks
+		trafficGen.record(r, w.id, i, stage)
+		// Print the request
+		logger.Print(r.String())
+
+		// Wait before the next request, unless the run is over
+		select {
+		case <-ctx.Done():
+		case <-trafficGen.over:
+		case <-time.After(trafficGen.thinkTime.next(w.rng)):
+		}
+	}
+}
+
+// newLogger returns the logger of the requests, with the given prefix
+func (trafficGen *TrafficGenerator) newLogger(prefix string) *log.Logger {
+	out := trafficGen.opts.Log
+	if out == nil {
+		out = io.Discard
+	}
+	return log.New(out, prefix, 0)
+}
+
+// isActive returns true if the worker is needed by the current stage of the
+// clients profile
+func (w *Worker) isActive() bool {
+	if w.trafficGen.profile == nil || w.Options().Rate > 0 {
+		return true
+	}
+	return w.id <= w.trafficGen.profileClients(time.Now())
+}
+
+// waitActive waits until the worker is needed by the current stage of the
+// clients profile, the context is canceled or the run is over
+func (w *Worker) waitActive(ctx context.Context) {
+	trafficGen := w.trafficGen
+	for {
+		// The channel is taken first, not to miss a change made after the
+		// check
+		trafficGen.clientsChangedMu.Lock()
+		changed := trafficGen.clientsChanged
+		trafficGen.clientsChangedMu.Unlock()
+		if w.isActive() {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-trafficGen.over:
+			return
+		case <-changed:
+		}
+	}
+}
+
+// watchClients wakes up the idle workers each time the number of clients of
+// the profile changes, until stop is closed
+func (trafficGen *TrafficGenerator) watchClients(stop chan struct{}) {
+	ticker := time.NewTicker(profileTick)
+	defer ticker.Stop()
+	last := trafficGen.profileClients(time.Now())
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			n := trafficGen.profileClients(now)
+			if n == last {
+				continue
+			}
+			last = n
+			trafficGen.clientsChangedMu.Lock()
+			close(trafficGen.clientsChanged)
+			trafficGen.clientsChanged = make(chan struct{})
+			trafficGen.clientsChangedMu.Unlock()
+		}
+	}
+}
+
+// profileClients returns the number of clients of the profile at the given
+// time
+func (trafficGen *TrafficGenerator) profileClients(t time.Time) int {
+	target, _ := trafficGen.profileAt(t)
+	return int(math.Round(target))
+}
+
+// profileAt returns the target and the name of the stage of the profile at
+// the given time
+func (trafficGen *TrafficGenerator) profileAt(t time.Time) (float64, string) {
+	if trafficGen.profile == nil {
+		return trafficGen.opts.Rate, ""
+	}
+	target, stage := trafficGen.profile.at(t.Sub(trafficGen.start))
+	if stage == nil {
+		return target, ""
+	}
+	return target, stage.Name
+}
+
+// record adds a request made by the given worker during the given stage to
+// the stats and to the sinks
+func (trafficGen *TrafficGenerator) record(r Request, worker, seq int, stage string) {
+	// The interrupted requests are only counted, they are not errors and
+	// their duration is cut short
+	if r.Criticity() == Interrupted {
+		trafficGen.interrupted.Add(1)
+	} else {
+		trafficGen.stats.AddRequest(r)
+		if trafficGen.progress != nil {
+			trafficGen.progress.AddRequest(r)
+		}
+		if trafficGen.stages != nil {
+			trafficGen.stages.AddRequest(stage, r)
+		}
+	}
+
+	if trafficGen.eventLog == nil && trafficGen.metrics == nil {
+		return
+	}
+	e := r.Event()
+	e.Type = trafficGen.opts.Type
+	e.Worker = worker
+	e.Seq = seq
+	e.Stage = stage
+	if trafficGen.metrics != nil {
+		trafficGen.metrics.AddEvent(e)
+	}
+	if trafficGen.eventLog != nil {
+		if err := trafficGen.eventLog.Write(e); err != nil {
+			trafficGen.logger.Printf("Error while writing the event log: %q", err)
+		}
+	}
+}
+
+// makeRequest makes a request on the given URL and keeps track of the
+// requests in flight
+func (trafficGen *TrafficGenerator) makeRequest(ctx context.Context, url *URLEntry, w *Worker, vars *RequestVars) Request {
+	if trafficGen.metrics != nil {
+		trafficGen.metrics.inFlight.Add(1)
+		defer trafficGen.metrics.inFlight.Add(-1)
+	}
+	return trafficGen.trafficType.Do(ctx, url, w, vars)
+}
+
+// trackWorker keeps track of the active workers, the returned function must
+// be called when the worker is done
+func (trafficGen *TrafficGenerator) trackWorker() func() {
+	if trafficGen.metrics == nil {
+		return func() {}
+	}
+	trafficGen.metrics.activeWorkers.Add(1)
+	return func() { trafficGen.metrics.activeWorkers.Add(-1) }
+}
+
+// SetMetrics sets the metrics fed with each request
+func (trafficGen *TrafficGenerator) SetMetrics(metrics *Metrics) {
+	trafficGen.metrics = metrics
+}
+
+// SetEventLog sets the event log where each request is written
+func (trafficGen *TrafficGenerator) SetEventLog(eventLog *EventLog) {
+	trafficGen.eventLog = eventLog
+}
+
+// stop stops making new requests, the reason is logged the first time
+func (trafficGen *TrafficGenerator) stop(reason string) {
+	trafficGen.stopOnce.Do(func() {
+		trafficGen.logger.Println(reason)
+		close(trafficGen.over)
+	})
+}
+
+// isOver returns true if the duration of the run is reached or if the run
+// is aborted
+func (trafficGen *TrafficGenerator) isOver() bool {
+	select {
+	case <-trafficGen.over:
+		return true
+	default:
+		return false
+	}
+}
+
+// getCounter returns the request counter used in the logs, the total number
+// of requests is unknown when the run is bounded by a duration
+func (trafficGen *TrafficGenerator) getCounter(i int) string {
+	if trafficGen.opts.Duration > 0 {
+		return fmt.Sprintf(" - %d ", i)
+	}
+	requests := trafficGen.opts.Requests
+	return fmt.Sprintf(fmt.Sprintf(" - %%0%dd/%%d ", getPadding(requests)), i, requests)
+}
+
+// dispatch makes the requests on a fixed schedule, whether or not the previous
+// ones are finished, the latency is measured from the scheduled start time
+func (trafficGen *TrafficGenerator) dispatch(ctx context.Context) {
+	defer trafficGen.wg.Done()
+	defer trafficGen.trackWorker()()
+	start := trafficGen.start
+	opts := &trafficGen.opts
+
+	// Limit the number of requests in flight if needed
+	var slots chan struct{}
+	if opts.MaxInFlight > 0 {
+		slots = make(chan struct{}, opts.MaxInFlight)
+	}
+
+	// The dispatcher is the worker of all the requests, the URLs are
+	// picked by it, in order, to be reproducible
+	w := trafficGen.NewWorker(0)
+	defer w.closeIdleConnections()
+
+	// Wait for the requests in flight before leaving
+	var inFlight sync.WaitGroup
+	defer inFlight.Wait()
+
+	scheduled := trafficGen.skipIdle(start)
+	for i := 1; opts.Duration > 0 || i <= opts.Requests; i, scheduled = i+1, trafficGen.nextDispatch(scheduled) {
+		// The profile has no more dispatches
+		if trafficGen.profile != nil && !scheduled.Before(start.Add(opts.Duration)) {
+			return
+		}
+
+		// Wait for the scheduled time, or quit if the context is canceled
+		timer := time.NewTimer(time.Until(scheduled))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-trafficGen.over:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		// Too many requests in flight, skip this one
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			default:
+				trafficGen.stats.AddMissed()
+				continue
+			}
+		}
+
+		lateness := time.Since(scheduled)
+		trafficGen.stats.AddDispatch(lateness)
+
+		// Find an URL
+		url := trafficGen.findRandomURL(w.rng)
+		_, stage := trafficGen.profileAt(scheduled)
+		// The requests run concurrently, each one gets its own random,
+		// seeded in order by the dispatcher
+		vars := &RequestVars{templates: trafficGen.templates, seq: i, seed: w.rng.Int63()}
+
+		inFlight.Add(1)
+		go func(i int) {
+			defer inFlight.Done()
+			if slots != nil {
+				defer func() { <-slots }()
+			}
+			logger := trafficGen.newLogger("rate" + trafficGen.getCounter(i))
+			// Make the request
+			r := trafficGen.makeRequest(ctx, url, w, vars)
+			// Count the time spent waiting to be dispatched
+			r.AddDelay(lateness)
+			// Add the request to the stats and the sinks
+			trafficGen.record(r, 0, i, stage)
+			// Print the request
+			logger.Print(r.String())
+		}(i)
+	}
+}
+
+// nextDispatch returns the time of the dispatch following the one scheduled
+// at the given time, with a profile the rate is integrated over time until
+// one request is due
+func (trafficGen *TrafficGenerator) nextDispatch(scheduled time.Time) time.Time {
+	if trafficGen.profile == nil {
+		return scheduled.Add(time.Duration(float64(time.Second) / trafficGen.opts.Rate))
+	}
+
+	end := trafficGen.start.Add(trafficGen.opts.Duration)
+	var due float64
+	for t := scheduled; t.Before(end); t = t.Add(profileTick) {
+		r, _ := trafficGen.profileAt(t)
+		if r > 0 && due+r*profileTick.Seconds() >= 1 {
+			return t.Add(time.Duration((1 - due) / r * float64(time.Second)))
+		}
+		due += r * profileTick.Seconds()
+	}
+	return end
+}
+
+// skipIdle returns the first time from the given one at which the rate of the
+// profile is positive, or the end of the run
+func (trafficGen *TrafficGenerator) skipIdle(t time.Time) time.Time {
+	end := trafficGen.start.Add(trafficGen.opts.Duration)
+	for {
+		if r, _ := trafficGen.profileAt(t); r > 0 || trafficGen.opts.Duration <= 0 || !t.Before(end) {
+			return t
+		}
+		t = t.Add(profileTick)
+	}
+}
+
+// newWorkerRand returns the random generator of a worker, its seed is
+// derived from the master seed and the worker id with splitmix64
+func newWorkerRand(seed int64, id int) *rand.Rand {
+	z := uint64(seed) + uint64(id+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return rand.New(rand.NewSource(int64(z)))
+}
+
+// getPadding returns the padding size of the int given
+func getPadding(nb int) int {
+	// Get the padding size : floor(log10(nb)) + 1
+	return int(math.Log10(float64(nb))) + 1
+}
+
+func getAvgDuration(total time.Duration, number int) string {
+	if number == 0 {
+		return "NaN"
+	}
+	return (total / time.Duration(number)).String()
+}
+
+// avgDuration returns the average duration, or 0 if there is none
+func avgDuration(total time.Duration, number int) time.Duration {
+	if number == 0 {
+		return 0
+	}
+	return total / time.Duration(number)
+}
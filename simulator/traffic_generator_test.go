@@ -0,0 +1,347 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOutput(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	th, err := ParseThreshold("error_rate<1%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	opts := DefaultOptions()
+	opts.Clients = 2
+	opts.Wait = 10 * time.Millisecond
+	opts.Requests = 0
+	opts.RateProfile = "ramp:50:300ms,hold:300ms"
+	opts.Interval = 200 * time.Millisecond
+	opts.Thresholds = []*Threshold{th}
+	opts.URLs = []URLEntry{{URL: ts.URL, Weight: 1}}
+	opts.Output = &out
+	trafficGen, err := NewTrafficGenerator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trafficGen.Generate(context.Background())
+	trafficGen.DisplayStats()
+	if !trafficGen.CheckThresholds() {
+		t.Errorf("CheckThresholds() = false, want the thresholds to pass")
+	}
+
+	for _, want := range []string{
+		"Progress ",
+		"\nStats :\n",
+		"\nPercentiles :\n",
+		"\nDuration histogram :\n",
+		"\nSchedule :\n",
+		"\nStages :\n",
+		"\nThresholds :\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("the output has no %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestScheduleStats(t *testing.T) {
+	var s ScheduleStats
+	for _, lateness := range []time.Duration{0, 500 * time.Microsecond, 5 * time.Millisecond, 2 * time.Millisecond} {
+		s.AddDispatch(lateness)
+	}
+	s.AddMissed()
+
+	want := &ScheduleSummary{Dispatched: 4, Late: 2, Missed: 1, AvgLateness: 1875 * time.Microsecond, MaxLateness: 5 * time.Millisecond}
+	if got := s.summary(10); *got != *want {
+		t.Errorf("summary() = %+v, want %+v", got, want)
+	}
+	if got := s.summary(0); got != nil {
+		t.Errorf("summary() without a rate = %+v, want nil", got)
+	}
+}
+
+func TestDispatchMissed(t *testing.T) {
+	// Each request lasts longer than the whole schedule
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	opts := DefaultOptions()
+	opts.Rate = 100
+	opts.Requests = 20
+	opts.MaxInFlight = 2
+	opts.URLs = []URLEntry{{URL: ts.URL, Weight: 1}}
+	opts.Output = io.Discard
+	trafficGen, err := NewTrafficGenerator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trafficGen.Generate(context.Background())
+
+	// The first two requests hold the slots until the end of the schedule,
+	// the other ones are missed
+	s := trafficGen.Summary()
+	if s.Schedule.Dispatched != 2 || s.Schedule.Missed != 18 {
+		t.Errorf("schedule = %+v, want 2 dispatched and 18 missed", s.Schedule)
+	}
+	if s.Requests != 2 || s.MinDuration < 500*time.Millisecond {
+		t.Errorf("Summary() = %d requests from %s, want 2 requests of at least 500ms", s.Requests, s.MinDuration)
+	}
+	if s.Schedule.MaxLateness > time.Second {
+		t.Errorf("max lateness = %s, want the dispatches on time", s.Schedule.MaxLateness)
+	}
+}
+
+func TestDurationStopsRun(t *testing.T) {
+	var last atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		last.Store(time.Now().UnixNano())
+	}))
+	defer ts.Close()
+
+	for _, mode := range []struct {
+		name string
+		rate float64
+	}{{"clients", 0}, {"rate", 50}} {
+		t.Run(mode.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Clients = 2
+			opts.Rate = mode.rate
+			// The duration overrides the number of requests
+			opts.Requests = 1000000
+			opts.Duration = 300 * time.Millisecond
+			opts.Wait = 10 * time.Millisecond
+			opts.URLs = []URLEntry{{URL: ts.URL, Weight: 1}}
+			opts.Output = io.Discard
+			trafficGen, err := NewTrafficGenerator(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			trafficGen.Generate(context.Background())
+			if elapsed := time.Since(start); elapsed < opts.Duration || elapsed > 5*time.Second {
+				t.Errorf("the run lasted %s, want it stopped after %s", elapsed, opts.Duration)
+			}
+			if s := trafficGen.Summary(); s.Requests == 0 || s.Requests >= opts.Requests {
+				t.Errorf("Summary() = %d requests, want the requests made during %s", s.Requests, opts.Duration)
+			}
+			// No request is started once the duration is reached
+			if end := start.Add(opts.Duration + 100*time.Millisecond); time.Unix(0, last.Load()).After(end) {
+				t.Errorf("a request was made %s after the end of the run", time.Unix(0, last.Load()).Sub(end))
+			}
+		})
+	}
+}
+
+func TestDrainInterruptsRequests(t *testing.T) {
+	// The first requests are quick, the following ones hang until they are
+	// aborted
+	var count atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if count.Add(1) <= 3 {
+			return
+		}
+		<-req.Context().Done()
+	}))
+	defer ts.Close()
+
+	for _, mode := range []struct {
+		name string
+		rate float64
+	}{{"clients", 0}, {"rate", 20}} {
+		t.Run(mode.name, func(t *testing.T) {
+			count.Store(0)
+			opts := DefaultOptions()
+			opts.Clients = 1
+			opts.Rate = mode.rate
+			opts.Requests = 0
+			opts.Duration = 300 * time.Millisecond
+			opts.Drain = 100 * time.Millisecond
+			opts.Timeout = time.Minute
+			opts.Wait = 0
+			opts.URLs = []URLEntry{{URL: ts.URL, Weight: 1}}
+			opts.Output = io.Discard
+			trafficGen, err := NewTrafficGenerator(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			trafficGen.Generate(context.Background())
+			if elapsed := time.Since(start); elapsed < opts.Duration+opts.Drain || elapsed > 5*time.Second {
+				t.Errorf("the run lasted %s, want the requests aborted after the drain", elapsed)
+			}
+
+			s := trafficGen.Summary()
+			if s.Requests != 3 || s.Interrupted == 0 {
+				t.Fatalf("Summary() = %d requests and %d interrupted, want 3 requests and the other ones interrupted", s.Requests, s.Interrupted)
+			}
+			if s.Criticities["interrupted"] != s.Interrupted || s.Criticities["critical"] != 0 {
+				t.Errorf("criticities = %v, want the aborted requests counted as interrupted only", s.Criticities)
+			}
+			// The interrupted requests are kept out of the durations
+			if s.MaxDuration > opts.Duration {
+				t.Errorf("max duration = %s, want the durations of the quick requests only", s.MaxDuration)
+			}
+			if s.Percentiles["p99.9"] > opts.Duration {
+				t.Errorf("p99.9 = %s, want the durations of the quick requests only", s.Percentiles["p99.9"])
+			}
+		})
+	}
+}
+
+func TestDrainLetsRequestsFinish(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	opts := DefaultOptions()
+	opts.Clients = 2
+	opts.Requests = 0
+	opts.Duration = 100 * time.Millisecond
+	opts.Drain = 5 * time.Second
+	opts.URLs = []URLEntry{{URL: ts.URL, Weight: 1}}
+	opts.Output = io.Discard
+	trafficGen, err := NewTrafficGenerator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trafficGen.Generate(context.Background())
+
+	// The requests in flight at the end of the duration finish within the
+	// drain period
+	if s := trafficGen.Summary(); s.Requests != 2 || s.Interrupted != 0 || s.MinDuration < 200*time.Millisecond {
+		t.Errorf("Summary() = %d requests from %s and %d interrupted, want 2 requests of 200ms", s.Requests, s.MinDuration, s.Interrupted)
+	}
+}
+
+func TestZeroDrainAbortsAtOnce(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}))
+	defer ts.Close()
+
+	opts := DefaultOptions()
+	opts.Clients = 2
+	opts.Requests = 0
+	opts.Duration = 100 * time.Millisecond
+	opts.Drain = 0
+	opts.Timeout = time.Minute
+	opts.URLs = []URLEntry{{URL: ts.URL, Weight: 1}}
+	opts.Output = io.Discard
+	trafficGen, err := NewTrafficGenerator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	trafficGen.Generate(context.Background())
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("the run lasted %s, want the requests aborted at once", elapsed)
+	}
+	if s := trafficGen.Summary(); s.Interrupted != 2 {
+		t.Errorf("Summary() = %d interrupted, want 2", s.Interrupted)
+	}
+}
+
+// seededRun runs 3 clients with the given seed and returns the URLs and the
+// bodies of the requests of each worker, in order, and the waits they drew
+func seededRun(t *testing.T, seed int64, rate float64) (map[string][]string, []time.Duration) {
+	t.Helper()
+	var mu sync.Mutex
+	requests := map[string][]string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		// The dispatcher makes its requests concurrently, they are sorted
+		// by their sequence number
+		key := req.Header.Get("X-Worker")
+		if rate > 0 {
+			key = req.Header.Get("X-Seq")
+		}
+		requests[key] = append(requests[key], req.URL.Path+" "+string(body))
+	}))
+	defer ts.Close()
+
+	opts := DefaultOptions()
+	opts.Seed = seed
+	opts.Clients = 3
+	opts.Requests = 10
+	opts.Rate = rate
+	opts.Wait = time.Millisecond
+	opts.WaitDistribution = ExponentialWait
+	opts.Method = http.MethodPost
+	opts.Headers = map[string]string{"X-Worker": "{{workerID}}", "X-Seq": "{{seq}}"}
+	opts.Body = "{{randString 8}}-{{randInt 1 1000}}"
+	opts.URLs = []URLEntry{
+		{URL: ts.URL + "/home", Weight: 70},
+		{URL: ts.URL + "/search/{{randInt 1 100}}", Weight: 25},
+		{URL: ts.URL + "/checkout", Weight: 5},
+	}
+	opts.Output = io.Discard
+	trafficGen, err := NewTrafficGenerator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trafficGen.Generate(context.Background())
+
+	var waits []time.Duration
+	w := trafficGen.NewWorker(1)
+	for i := 0; i < 10; i++ {
+		waits = append(waits, trafficGen.thinkTime.next(w.rng))
+	}
+	return requests, waits
+}
+
+func TestSeedReproducesTheRun(t *testing.T) {
+	for _, mode := range []struct {
+		name string
+		rate float64
+	}{{"clients", 0}, {"rate", 200}} {
+		t.Run(mode.name, func(t *testing.T) {
+			a, waitsA := seededRun(t, 42, mode.rate)
+			b, waitsB := seededRun(t, 42, mode.rate)
+			if len(a) == 0 || !reflect.DeepEqual(a, b) {
+				t.Errorf("the requests of two runs with the same seed differ:\n%v\n%v", a, b)
+			}
+			if !reflect.DeepEqual(waitsA, waitsB) {
+				t.Errorf("the waits of two runs with the same seed differ:\n%v\n%v", waitsA, waitsB)
+			}
+
+			c, waitsC := seededRun(t, 43, mode.rate)
+			if reflect.DeepEqual(a, c) || reflect.DeepEqual(waitsA, waitsC) {
+				t.Errorf("two runs with different seeds made the same requests")
+			}
+		})
+	}
+}
+
+func TestWorkerRandsDiffer(t *testing.T) {
+	a, b, c := newWorkerRand(42, 1), newWorkerRand(42, 1), newWorkerRand(42, 2)
+	x, y, z := a.Int63(), b.Int63(), c.Int63()
+	if x != y {
+		t.Errorf("the same seed and worker gave %d and %d, want the same value", x, y)
+	}
+	if x == z {
+		t.Errorf("two workers got the same value %d, want their own sequences", x)
+	}
+}
@@ -0,0 +1,83 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// ErrInvalidTrafficType is returned if the traffic type is invalid
+var ErrInvalidTrafficType = errors.New("invalid traffic type")
+
+// RequestFunc makes a request on the URL for the worker and returns it, the
+// templates of the URL are evaluated with the variables of the request. The
+// request is aborted when the context is canceled, its criticity is then
+// Interrupted
+type RequestFunc func(ctx context.Context, entry *URLEntry, w *Worker, vars *RequestVars) Request
+
+// TrafficType represents a type of traffic: how its requests are made, how
+// their stats are aggregated and how its options are checked
+type TrafficType struct {
+	// Do makes a request, it is called concurrently by the workers
+	Do RequestFunc
+	// NewStats returns the stats of a run, NewDNSStats only relies on the
+	// Request interface and suits most of the traffic types
+	NewStats func(*Options) Stats
+	// Configure checks the options of a run, like its Params, and fills
+	// their defaults, it is optional
+	Configure func(*Options) error
+}
+
+var (
+	trafficTypesMu sync.RWMutex
+	trafficTypes   = map[string]TrafficType{
+		HTTPTraffic:  {Do: getURL, NewStats: NewHTTPStats},
+		HTTP2Traffic: {Do: getURL, NewStats: NewHTTPStats},
+		DNSTraffic:   {Do: lookupURL, NewStats: NewDNSStats},
+		DoHTraffic:   {Do: lookupDoH, NewStats: NewDNSStats, Configure: configureDoH},
+		DoTTraffic:   {Do: lookupDoT, NewStats: NewDNSStats, Configure: configureDoT},
+	}
+)
+
+// RegisterTrafficType registers a traffic type under the given name, which
+// can then be used as the Type of the options
+func RegisterTrafficType(name string, t TrafficType) error {
+	if name == "" {
+		return errors.New("the traffic type needs a name")
+	}
+	if t.Do == nil || t.NewStats == nil {
+		return fmt.Errorf("the traffic type %q needs a Do and a NewStats function", name)
+	}
+	trafficTypesMu.Lock()
+	defer trafficTypesMu.Unlock()
+	if _, ok := trafficTypes[name]; ok {
+		return fmt.Errorf("the traffic type %q is already registered", name)
+	}
+	trafficTypes[name] = t
+	return nil
+}
+
+// TrafficTypes returns the sorted names of the registered traffic types
+func TrafficTypes() []string {
+	trafficTypesMu.RLock()
+	defer trafficTypesMu.RUnlock()
+	return slices.Sorted(maps.Keys(trafficTypes))
+}
+
+// IsValidTrafficType returns true if the requests of the traffic type can be
+// generated
+func IsValidTrafficType(trafficType string) bool {
+	_, ok := lookupTrafficType(trafficType)
+	return ok
+}
+
+// lookupTrafficType returns the traffic type registered under the name
+func lookupTrafficType(name string) (TrafficType, bool) {
+	trafficTypesMu.RLock()
+	defer trafficTypesMu.RUnlock()
+	t, ok := trafficTypes[name]
+	return t, ok
+}
@@ -1,12 +1,20 @@
-package main
+package simulator
 
 import (
 	"bufio"
 	"errors"
-	"log"
+	"fmt"
 	"math/rand"
+	"mime"
+	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
 )
 
 var defaultURLs = []string{
@@ -875,43 +883,276 @@ var defaultURLs = []string{
 	"zulily.com",
 }
 
-// getURLs will open the given file and read it to get a list of URLs
-func getURLs() error {
-	// If no fileName is given, use the defaultURLs variable
-	if fileName == "" {
-		URLs = defaultURLs
-		return nil
-	}
+// URLEntry represents an URL to test, its weight in the traffic mix and the
+// metadata of its requests
+type URLEntry struct {
+	URL            string
+	Weight         float64
+	Method         string
+	Headers        map[string]string
+	Body           string
+	ContentType    string
+	ExpectedStatus []int
+	Assertions     Assertions
+}
 
-	file, err := os.Open(fileName)
+// LoadURLs reads the URLs of a file, one per line followed by optional
+// attributes, the empty lines and the comments starting with # are skipped
+func LoadURLs(path string) ([]URLEntry, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer file.Close()
 
+	entries := []URLEntry{}
 	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		u := scanner.Text()
-		if _, err := url.Parse(u); err != nil {
-			log.Printf("Invalid URL: %q", u)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		// Skip the empty lines and the comments
+		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
 
-		URLs = append(URLs, u)
+		entry, err := parseURLLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err)
+		}
+		// The templated URLs are only known once evaluated
+		if _, err := url.Parse(NormalizeURL(entry.URL)); err != nil && !strings.Contains(entry.URL, "{{") {
+			return nil, fmt.Errorf("line %d: invalid URL %q", lineNum, entry.URL)
+		}
+
+		entries = append(entries, entry)
 	}
 
 	if err := scanner.Err(); err != nil {
-		return err
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.New("no URL found")
+	}
+	return entries, nil
+}
+
+// parseURLLine parses a line of the URL source: an URL followed by optional
+// attributes, like:
+//
+//	example.com/checkout weight=5 method=POST header="Authorization: Bearer x" status=200,201
+//
+// The values with spaces are quoted. The body is given with body=, escaped like
+// a query string, or with body_file=, and its type with content_type=
+func parseURLLine(line string) (URLEntry, error) {
+	fields, err := splitURLLine(line)
+	if err != nil {
+		return URLEntry{}, err
+	}
+	entry := URLEntry{URL: fields[0], Weight: 1}
+
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return entry, fmt.Errorf("invalid attribute %q, expected key=value", field)
+		}
+
+		switch key {
+		case "weight":
+			w, err := strconv.ParseFloat(value, 64)
+			if err != nil || w < 0 {
+				return entry, fmt.Errorf("invalid weight %q", value)
+			}
+			entry.Weight = w
+		case "method":
+			if !IsValidMethod(value) {
+				return entry, fmt.Errorf("invalid method %q", value)
+			}
+			entry.Method = strings.ToUpper(value)
+		case "header":
+			name, v, ok := strings.Cut(value, ":")
+			name = strings.TrimSpace(name)
+			if !ok || name == "" || strings.ContainsAny(name, " \t") {
+				return entry, fmt.Errorf("invalid header %q, expected Name:value", value)
+			}
+			if entry.Headers == nil {
+				entry.Headers = map[string]string{}
+			}
+			entry.Headers[http.CanonicalHeaderKey(name)] = strings.TrimSpace(v)
+		case "body":
+			b, err := url.QueryUnescape(value)
+			if err != nil {
+				return entry, fmt.Errorf("invalid body %q", value)
+			}
+			entry.Body = b
+		case "body_file":
+			b, contentType, err := ReadBodyFile(value)
+			if err != nil {
+				return entry, err
+			}
+			entry.Body = b
+			if entry.ContentType == "" {
+				entry.ContentType = contentType
+			}
+		case "content_type":
+			entry.ContentType = value
+		case "status":
+			for _, code := range strings.Split(value, ",") {
+				c, err := strconv.Atoi(code)
+				if err != nil || !IsValidStatus(c) {
+					return entry, fmt.Errorf("invalid status %q", code)
+				}
+				entry.ExpectedStatus = append(entry.ExpectedStatus, c)
+			}
+		case "expect_body":
+			b, err := url.QueryUnescape(value)
+			if err != nil {
+				return entry, fmt.Errorf("invalid expected body %q", value)
+			}
+			entry.Assertions.BodyContains = b
+		case "expect_regex":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return entry, fmt.Errorf("invalid expected regex %q: %s", value, err)
+			}
+			entry.Assertions.BodyRegex = re
+		case "expect_json":
+			j, err := ParseJSONAssertion(value)
+			if err != nil {
+				return entry, err
+			}
+			entry.Assertions.JSON = append(entry.Assertions.JSON, j)
+		case "expect_header":
+			entry.Assertions.Headers = append(entry.Assertions.Headers, value)
+		case "max_size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size <= 0 {
+				return entry, fmt.Errorf("invalid max size %q", value)
+			}
+			entry.Assertions.MaxBodySize = size
+		default:
+			return entry, fmt.Errorf("unknown attribute %q", key)
+		}
+	}
+	return entry, nil
+}
+
+// splitURLLine splits a line of the URL source on the spaces, except in the
+// double-quoted values and in the actions of the templates like
+// {{randInt 1 10}}, the quotes are removed and \" is a quote in a value
+func splitURLLine(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	var inAction, inQuotes bool
+	for i := 0; i < len(line); i++ {
+		switch {
+		case strings.HasPrefix(line[i:], "{{"):
+			inAction = true
+		case strings.HasPrefix(line[i:], "}}"):
+			inAction = false
+		case inAction:
+		case inQuotes && strings.HasPrefix(line[i:], `\"`):
+			i++
+		case line[i] == '"':
+			inQuotes = !inQuotes
+			continue
+		case !inQuotes && (line[i] == ' ' || line[i] == '\t'):
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+			continue
+		}
+		field.WriteByte(line[i])
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote in %q", line)
 	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+// ReadBodyFile returns the content of a body file and its content type,
+// guessed from its extension
+func ReadBodyFile(path string) (string, string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	return string(b), mime.TypeByExtension(filepath.Ext(path)), nil
+}
 
-	if len(URLs) == 0 {
-		return errors.New("no URL found")
+// IsValidMethod returns true if the HTTP method is a valid token
+func IsValidMethod(method string) bool {
+	if method == "" {
+		return false
 	}
+	for _, c := range method {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune("!#$%&'*+-.^_`|~", c) {
+			return false
+		}
+	}
+	return true
+}
 
-	return nil
+// IsValidStatus returns true if the HTTP status code is valid
+func IsValidStatus(code int) bool {
+	return code >= 100 && code <= 599
 }
 
-// findRandomURL will return a random URL
-func findRandomURL() string {
-	return URLs[rand.Intn(len(URLs))]
+// schemeRegexp matches the scheme at the start of an URL, like "https://"
+var schemeRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*://`)
+
+// NormalizeURL returns the full URL, bare hostnames and paths like
+// "example.com/health" use the http scheme
+func NormalizeURL(raw string) string {
+	if schemeRegexp.MatchString(raw) {
+		return raw
+	}
+	return "http://" + raw
+}
+
+// hostname returns the hostname of an URL, without the scheme, the port and
+// the path
+func hostname(raw string) string {
+	u, err := url.Parse(NormalizeURL(raw))
+	if err != nil || u.Hostname() == "" {
+		return raw
+	}
+	return u.Hostname()
+}
+
+// DefaultURLs returns the URLs tested by default, of the same weight
+func DefaultURLs() []URLEntry {
+	entries := make([]URLEntry, 0, len(defaultURLs))
+	for _, u := range defaultURLs {
+		entries = append(entries, URLEntry{URL: u, Weight: 1})
+	}
+	return entries
+}
+
+// setURLs sets the URLs to test and computes their cumulative weights
+func (trafficGen *TrafficGenerator) setURLs(entries []URLEntry) {
+	trafficGen.urls = entries
+	trafficGen.cumulativeWeights = make([]float64, len(entries))
+	var total float64
+	for i, e := range entries {
+		total += e.Weight
+		trafficGen.cumulativeWeights[i] = total
+	}
+}
+
+// findRandomURL will return a random URL, according to the weights
+func (trafficGen *TrafficGenerator) findRandomURL(rng *rand.Rand) *URLEntry {
+	weights := trafficGen.cumulativeWeights
+	x := rng.Float64() * weights[len(weights)-1]
+	i := sort.Search(len(weights), func(i int) bool {
+		return weights[i] > x
+	})
+	// Guard against rounding errors
+	if i == len(trafficGen.urls) {
+		i--
+	}
+	return &trafficGen.urls[i]
 }
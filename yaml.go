@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlToJSON decodes a YAML document and returns it as JSON, the scalars
+// expected as strings by the given type keep their text, like
+// "min_version: 1.2"
+func yamlToJSON(data []byte, t reflect.Type) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	// An empty document is an empty mapping
+	if doc.Kind == 0 {
+		return []byte("{}"), nil
+	}
+	v, err := yamlValue(&doc, t)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// yamlValue returns the value of a YAML node as maps, slices and scalars,
+// given the type it is decoded into
+func yamlValue(node *yaml.Node, t reflect.Type) (interface{}, error) {
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		return yamlValue(node.Content[0], t)
+	case yaml.AliasNode:
+		return yamlValue(node.Alias, t)
+	case yaml.MappingNode:
+		m := map[string]interface{}{}
+		var merged []*yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: expected a scalar key", key.Line)
+			}
+			// The merged mappings are applied last, the keys of the mapping
+			// override theirs
+			if key.Tag == "!!merge" {
+				merged = append(merged, value)
+				continue
+			}
+			v, err := yamlValue(value, yamlFieldType(t, key.Value))
+			if err != nil {
+				return nil, err
+			}
+			m[key.Value] = v
+		}
+		for _, value := range merged {
+			if err := mergeYAMLMapping(m, value, t); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		var elem reflect.Type
+		if t != nil && t.Kind() == reflect.Slice {
+			elem = t.Elem()
+		}
+		seq := make([]interface{}, 0, len(node.Content))
+		for _, item := range node.Content {
+			v, err := yamlValue(item, elem)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+		}
+		return seq, nil
+	}
+
+	// Scalars expected as strings are kept as written
+	if t != nil && t.Kind() == reflect.String && node.Tag != "!!null" {
+		return node.Value, nil
+	}
+	var v interface{}
+	if err := node.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// mergeYAMLMapping adds the keys of the mappings given to a "<<" merge key
+// which are not set yet
+func mergeYAMLMapping(m map[string]interface{}, node *yaml.Node, t reflect.Type) error {
+	if node.Kind == yaml.SequenceNode {
+		for _, item := range node.Content {
+			if err := mergeYAMLMapping(m, item, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	v, err := yamlValue(node, t)
+	if err != nil {
+		return err
+	}
+	mapping, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("line %d: expected a mapping to merge", node.Line)
+	}
+	for key, value := range mapping {
+		if _, ok := m[key]; !ok {
+			m[key] = value
+		}
+	}
+	return nil
+}
+
+// yamlFieldType returns the type of the value of the given key, in a map or a
+// struct decoded from JSON, nil if unknown
+func yamlFieldType(t reflect.Type, key string) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Map:
+		return t.Elem()
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if strings.Split(t.Field(i).Tag.Get("json"), ",")[0] == key {
+				return t.Field(i).Type
+			}
+		}
+	}
+	return nil
+}
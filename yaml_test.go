@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{"empty", "", `{}`},
+		{"comments", "---\n# comment\ntype: http # trailing\n", `{"type": "http"}`},
+		{
+			"scalars",
+			"clients: 42\nrate: 1.5\nfollow_redirect: true\nurl_source: ~\ntype: 'it''s'\n",
+			`{"clients": 42, "rate": 1.5, "follow_redirect": true, "url_source": null, "type": "it's"}`,
+		},
+		{
+			"strings kept as written",
+			"type: true\noutput:\n  summary: 1.20\nheaders:\n  X-Id: 042\nurls:\n  - url: 1.5\n",
+			`{"type": "true", "output": {"summary": "1.20"}, "headers": {"X-Id": "042"}, "urls": [{"url": "1.5"}]}`,
+		},
+		{
+			"block scalars",
+			"headers:\n  X-Note: |\n    first\n    second\nurl_source: >\n  urls.txt\n",
+			`{"headers": {"X-Note": "first\nsecond\n"}, "url_source": "urls.txt\n"}`,
+		},
+		{
+			"multi-line flow sequence",
+			"urls: [\n  {url: example.com, weight: 2},\n  {url: example.org},\n]\n",
+			`{"urls": [{"url": "example.com", "weight": 2}, {"url": "example.org"}]}`,
+		},
+		{
+			"anchors and aliases",
+			"headers: &h\n  X-A: a\nurls:\n  - url: &u example.com\n  - url: *u\noutput:\n  summary: *u\n",
+			`{"headers": {"X-A": "a"}, "urls": [{"url": "example.com"}, {"url": "example.com"}], "output": {"summary": "example.com"}}`,
+		},
+		{
+			"merge keys",
+			"output:\n  summary: results.json\n  event_log: events.jsonl\nheaders:\n  <<: {X-A: a, X-B: b}\n  X-B: c\n",
+			`{"output": {"summary": "results.json", "event_log": "events.jsonl"}, "headers": {"X-A": "a", "X-B": "c"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := yamlToJSON([]byte(tt.doc), reflect.TypeOf(Scenario{}))
+			if err != nil {
+				t.Fatalf("yamlToJSON() error = %s", err)
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("yamlToJSON() = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestYAMLToJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{"tab indentation", "output:\n\tsummary: results.json\n", "line 2"},
+		{"unterminated flow sequence", "urls: [example.com\n", "did not find expected ',' or ']'"},
+		{"unterminated quote", "type: \"http\n", "found unexpected end of stream"},
+		{"unknown alias", "headers: *h\n", "unknown anchor 'h'"},
+		{"collection key", "? [a, b]\n: c\n", "expected a scalar key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := yamlToJSON([]byte(tt.doc), reflect.TypeOf(Scenario{}))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("yamlToJSON() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}